@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// adminSocketFilename is the unix socket of the admin API in the working directory
+const adminSocketFilename = "admin.sock"
+
+// errUploadsPaused is returned when the queue can't be flushed because uploads are paused
+var errUploadsPaused = errors.New("uploads are paused, resume them first")
+
+// AdminController controls the reader and the uploader loops of the running jsumo. The
+// actions are executed by the loops themselves, so they never run concurrently with a
+// regular read or upload
+type AdminController struct {
+	sync.Mutex
+	paused        bool
+	reader        *JournalReader
+	readerTasks   chan func(ctx context.Context)
+	uploaderTasks chan func(ctx context.Context)
+}
+
+// DropResult is the result of dropping the upload queue
+type DropResult struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Pause stops uploads, logs are still read and spooled
+func (c *AdminController) Pause() {
+	c.Lock()
+	defer c.Unlock()
+	if !c.paused {
+		Logger.Warn("Uploads are paused")
+	}
+	c.paused = true
+	metricUploadsPaused.Set(1)
+}
+
+// Resume starts uploads again
+func (c *AdminController) Resume() {
+	c.Lock()
+	defer c.Unlock()
+	if c.paused {
+		Logger.Warn("Uploads are resumed")
+	}
+	c.paused = false
+	metricUploadsPaused.Set(0)
+}
+
+// Paused returns true if uploads are paused
+func (c *AdminController) Paused() bool {
+	if c == nil {
+		return false
+	}
+	c.Lock()
+	defer c.Unlock()
+	return c.paused
+}
+
+// run sends the task to the loop and waits until it is done or the context is cancelled
+func (c *AdminController) run(ctx context.Context, tasks chan func(ctx context.Context), task func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+	select {
+	case tasks <- func(loopCtx context.Context) { done <- task(loopCtx) }:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush uploads all queued batch files, reads new logs from journalctl and uploads them
+// as well. New logs aren't read while batch files are waiting, so the queue is drained
+// before and after reading
+func (c *AdminController) Flush(ctx context.Context) error {
+	if c.Paused() {
+		return errUploadsPaused
+	}
+	Logger.Warn("Flushing logs...")
+	if err := c.drain(ctx); err != nil {
+		return err
+	}
+	err := c.run(ctx, c.readerTasks, func(loopCtx context.Context) error {
+		return c.reader.ReadLogs(loopCtx)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to read logs: %w", err)
+	}
+	return c.drain(ctx)
+}
+
+// drain uploads all queued batch files in the uploader loop
+func (c *AdminController) drain(ctx context.Context) error {
+	return c.run(ctx, c.uploaderTasks, func(loopCtx context.Context) error {
+		for UploadQueue.Len() > 0 {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err := uploadNextBatch(loopCtx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Drop removes all queued batch files, their logs are never uploaded
+func (c *AdminController) Drop(ctx context.Context) (DropResult, error) {
+	result := DropResult{}
+	err := c.run(ctx, c.uploaderTasks, func(loopCtx context.Context) error {
+		for {
+			filename := UploadQueue.Next()
+			if filename == "" {
+				return nil
+			}
+			if info, err := os.Stat(filename); err == nil {
+				result.Bytes += info.Size()
+			}
+			if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+				UploadQueue.ReturnFile(filename)
+				return err
+			}
+			removeBatchMetadata(filename)
+			result.Files++
+			metricDroppedBatches.Inc()
+			Logger.Error("Batch file dropped, its logs won't be uploaded", attrFile, filename)
+		}
+	})
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		// The task may be still running
+		return DropResult{}, err
+	}
+	return result, err
+}
+
+// writeAdminResponse writes the value as JSON or the error
+func writeAdminResponse(w http.ResponseWriter, value interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(value)
+}
+
+// newAdminHandler returns the handler of the admin API:
+//   - POST /pause - pause uploads, logs are still read
+//   - POST /resume - resume uploads
+//   - POST /flush - read logs and upload all queued batch files
+//   - POST /drop - remove all queued batch files
+//   - GET /queue - list queued batch files
+func newAdminHandler(c *AdminController) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		c.Pause()
+		writeAdminResponse(w, map[string]bool{"paused": true}, nil)
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		c.Resume()
+		writeAdminResponse(w, map[string]bool{"paused": false}, nil)
+	})
+	mux.HandleFunc("POST /flush", func(w http.ResponseWriter, r *http.Request) {
+		err := c.Flush(r.Context())
+		writeAdminResponse(w, map[string]int{"queue": UploadQueue.Len()}, err)
+	})
+	mux.HandleFunc("POST /drop", func(w http.ResponseWriter, r *http.Request) {
+		result, err := c.Drop(r.Context())
+		writeAdminResponse(w, result, err)
+	})
+	mux.HandleFunc("GET /queue", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminResponse(w, queuedBatches(), nil)
+	})
+	return mux
+}
+
+// adminSocketPath returns the path of the admin socket, by default it is in the working directory
+func adminSocketPath() (string, error) {
+	if FlagAdminSocket != "" {
+		return FlagAdminSocket, nil
+	}
+	dir, err := getStateDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, adminSocketFilename), nil
+}
+
+// StartAdminServer serves the admin API on the unix socket in the background. The
+// socket is accessible only by the owner
+func StartAdminServer(socket string, c *AdminController) (*http.Server, error) {
+	listener, err := listen(unixSocketPrefix + socket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %w", socket, err)
+	}
+	// The umask is process-wide, so the permissions are set right after the socket is created
+	if err := os.Chmod(socket, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("unable to restrict access to %s: %w", socket, err)
+	}
+	server := &http.Server{
+		Handler:           newAdminHandler(c),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			Logger.Error("Admin API stopped", errAttr(err))
+		}
+	}()
+	Logger.Debug("Admin API is served", "socket", socket)
+	return server, nil
+}
+
+// NewAdminController creates a new controller of the loops
+func NewAdminController(reader *JournalReader) *AdminController {
+	return &AdminController{
+		reader:        reader,
+		readerTasks:   make(chan func(ctx context.Context)),
+		uploaderTasks: make(chan func(ctx context.Context)),
+	}
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStartAdminServer(t *testing.T) {
+	socket := path.Join(t.TempDir(), adminSocketFilename)
+	previousSocket, previousTimeout := FlagAdminSocket, FlagCtlTimeout
+	t.Cleanup(func() { FlagAdminSocket, FlagCtlTimeout = previousSocket, previousTimeout })
+	FlagAdminSocket, FlagCtlTimeout = socket, 5*time.Second
+
+	umask := syscall.Umask(0022)
+	defer syscall.Umask(umask)
+	server, err := StartAdminServer(socket, NewAdminController(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// The permissions of the socket are restricted without changing the umask
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("socket permissions are %s, want -rw-------", info.Mode().Perm())
+	}
+	if current := syscall.Umask(0022); current != 0022 {
+		t.Errorf("umask is %o, want 022", current)
+	}
+
+	var queue []StatusBatch
+	if err := callAdminAPI(context.Background(), "GET", "/queue", &queue); err != nil {
+		t.Fatal(err)
+	}
+}
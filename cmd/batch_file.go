@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressBatch compresses the logs with zstd, as they are stored in the batch file
+func compressBatch(data []byte) ([]byte, error) {
+	// Create a buffer to hold the compressed data
+	var compressedData bytes.Buffer
+
+	// Create a zstd encoder
+	encoder, err := zstd.NewWriter(&compressedData)
+	if err != nil {
+		return nil, err
+	}
+	defer encoder.Close()
+
+	// Write the data to the encoder
+	_, err = encoder.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Flush the encoder to ensure all data is written
+	err = encoder.Close()
+	if err != nil {
+		return nil, err
+	}
+	return compressedData.Bytes(), nil
+}
+
+// decompressBatch decompresses the content of the batch file
+func decompressBatch(data []byte) ([]byte, error) {
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+	return decoder.DecodeAll(data, nil)
+}
+
+// isBatchFile returns true if the name is the name of a batch file
+func isBatchFile(name string) bool {
+	return strings.HasPrefix(name, batchFilenamePrefix) && strings.HasSuffix(name, batchFilenameSuffix)
+}
+
+// highestBatchCounter returns the highest counter of the batch files or 0 if there are none
+func highestBatchCounter(files []string) int {
+	highest := 0
+	for _, file := range files {
+		name := strings.TrimSuffix(strings.TrimPrefix(path.Base(file), batchFilenamePrefix), batchFilenameSuffix)
+		if counter, err := strconv.Atoi(name); err == nil && counter > highest {
+			highest = counter
+		}
+	}
+	return highest
+}
+
+// splitBatchEntries splits the logs of the batch file into entries. The following lines
+// of a multiline message are indented, so they belong to the previous entry
+func splitBatchEntries(logs []byte) []string {
+	entries := []string{}
+	for _, line := range strings.Split(strings.TrimRight(string(logs), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, " ") && len(entries) > 0 {
+			entries[len(entries)-1] += "\n" + line
+			continue
+		}
+		entries = append(entries, line)
+	}
+	return entries
+}
+
+// entryTime parses the time at the beginning of the formatted entry, see JournalEntry.Format
+func entryTime(entry string) (time.Time, bool) {
+	timestamp, _, _ := strings.Cut(entry, " ")
+	t, err := time.Parse(journalTimeFormat, timestamp)
+	return t, err == nil
+}
+
+// BatchSummary describes the content of a batch file
+type BatchSummary struct {
+	File             string        `json:"file"`
+	CompressedSize   int           `json:"compressed_size"`
+	DecompressedSize int           `json:"decompressed_size"`
+	Entries          int           `json:"entries"`
+	Lines            int           `json:"lines"`
+	First            *time.Time    `json:"first,omitempty"`
+	Last             *time.Time    `json:"last,omitempty"`
+	Metadata         BatchMetadata `json:"metadata"`
+	CreatedAt        time.Time     `json:"created_at"`
+}
+
+// Ratio returns the compression ratio of the batch file
+func (s BatchSummary) Ratio() float64 {
+	if s.CompressedSize == 0 {
+		return 0
+	}
+	return float64(s.DecompressedSize) / float64(s.CompressedSize)
+}
+
+// readBatchFile reads and decompresses the batch file. The entries and the summary with
+// the metadata of the batch file are returned
+func readBatchFile(filename string) ([]string, BatchSummary, error) {
+	summary := BatchSummary{File: filename}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, summary, err
+	}
+	summary.CreatedAt = info.ModTime()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, summary, err
+	}
+	logs, err := decompressBatch(data)
+	if err != nil {
+		return nil, summary, err
+	}
+	summary.CompressedSize = len(data)
+	summary.DecompressedSize = len(logs)
+	summary.Metadata, err = readBatchMetadata(filename)
+	if err != nil {
+		return nil, summary, err
+	}
+
+	entries := splitBatchEntries(logs)
+	summary.Entries = len(entries)
+	for _, entry := range entries {
+		summary.Lines += strings.Count(entry, "\n") + 1
+		t, ok := entryTime(entry)
+		if !ok {
+			continue
+		}
+		if summary.First == nil || t.Before(*summary.First) {
+			summary.First = &t
+		}
+		if summary.Last == nil || t.After(*summary.Last) {
+			summary.Last = &t
+		}
+	}
+	return entries, summary, nil
+}
@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// metadataFileSuffix is the suffix of the file with the metadata of a batch file
+const metadataFileSuffix = ".meta"
+
+// priorityNames are the names of syslog priorities, as used by journalctl --priority
+var priorityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// BatchMetadata is the metadata sent with a batch file in X-Sumo-* headers. It overrides
+// the metadata configured in the HTTP source. Destination is the name of the receiver
+// the batch file is uploaded to, empty for the default destination
+// Ref: https://help.sumologic.com/docs/send-data/hosted-collectors/http-source/logs-metrics/upload-logs/#supported-http-headers
+type BatchMetadata struct {
+	Destination string            `json:"destination,omitempty"`
+	Category    string            `json:"category,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	Host        string            `json:"host,omitempty"`
+	Fields      map[string]string `json:"fields,omitempty"`
+}
+
+// IsEmpty returns true if no metadata is set
+func (m BatchMetadata) IsEmpty() bool {
+	return m.Destination == "" && m.Category == "" && m.Name == "" && m.Host == "" && len(m.Fields) == 0
+}
+
+// DestinationName returns the name of the destination, default if it isn't set
+func (m BatchMetadata) DestinationName() string {
+	if m.Destination == "" {
+		return defaultDestination
+	}
+	return m.Destination
+}
+
+// key identifies batches with the same metadata
+func (m BatchMetadata) key() string {
+	// Map keys are sorted when marshaled, so the key is stable
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+// setHeaders sets the X-Sumo-* headers of the request to the receiver
+func (m BatchMetadata) setHeaders(header http.Header) {
+	if m.Category != "" {
+		header.Set("X-Sumo-Category", m.Category)
+	}
+	if m.Name != "" {
+		header.Set("X-Sumo-Name", m.Name)
+	}
+	if m.Host != "" {
+		header.Set("X-Sumo-Host", m.Host)
+	}
+	if len(m.Fields) > 0 {
+		fields := []string{}
+		for name, value := range m.Fields {
+			fields = append(fields, name+"="+value)
+		}
+		sort.Strings(fields)
+		header.Set("X-Sumo-Fields", strings.Join(fields, ","))
+	}
+}
+
+// writeBatchMetadata stores the metadata of the batch file next to it. Batch filenames
+// are reused, so a stale metadata file is removed if the metadata is empty
+func writeBatchMetadata(batchFilename string, metadata BatchMetadata) error {
+	filename := batchFilename + metadataFileSuffix
+	if metadata.IsEmpty() {
+		err := os.Remove(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// readBatchMetadata reads the metadata of the batch file. Batch files without the
+// metadata file have empty metadata
+func readBatchMetadata(batchFilename string) (BatchMetadata, error) {
+	metadata := BatchMetadata{}
+	data, err := os.ReadFile(batchFilename + metadataFileSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return metadata, nil
+		}
+		return metadata, err
+	}
+	err = json.Unmarshal(data, &metadata)
+	return metadata, err
+}
+
+// removeBatchMetadata removes the metadata file of the batch file
+func removeBatchMetadata(batchFilename string) {
+	err := os.Remove(batchFilename + metadataFileSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		Logger.Error("Unable to remove the metadata of the batch file", attrFile, batchFilename, errAttr(err))
+	}
+}
+
+// MetadataRenderer renders the metadata of journal entries from the templates over
+// journal fields, e.g. "prod/{{unit}}" or "{{identifier}}-{{priority}}". The first
+// route which matches the entry sets its destination and may override its category
+type MetadataRenderer struct {
+	category *template.Template
+	name     *template.Template
+	host     *template.Template
+	fields   map[string]*template.Template
+	routes   []*Route
+	entry    JournalEntry // Entry which is rendered, used by the template functions
+}
+
+// funcs returns the functions available in the metadata templates, they return the
+// fields of the entry which is rendered
+func (r *MetadataRenderer) funcs() template.FuncMap {
+	funcs := template.FuncMap{
+		"unit":       func() string { return r.entry.Unit() },
+		"identifier": func() string { return r.entry.Identifier() },
+		"hostname":   func() string { return r.entry["_HOSTNAME"] },
+		"priority":   func() string { return priorityNames[min(max(r.entry.Priority(), 0), len(priorityNames)-1)] },
+		"field":      func(name string) string { return r.entry[name] },
+		"var":        func(name string) string { return FlagTemplateVars[name] },
+	}
+	for name, f := range namingFuncs {
+		funcs[name] = f
+	}
+	return funcs
+}
+
+// parse parses the metadata template, empty templates are skipped
+func (r *MetadataRenderer) parse(what, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New(what).Funcs(r.funcs()).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", what, err)
+	}
+	return tmpl, nil
+}
+
+// execute renders the template for the entry. Errors are logged, so a single broken
+// entry doesn't stop the processing of logs
+func (r *MetadataRenderer) execute(tmpl *template.Template) string {
+	if tmpl == nil {
+		return ""
+	}
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, map[string]string(r.entry)); err != nil {
+		Logger.Debug("Unable to render template", "template", tmpl.Name(), errAttr(err))
+		return ""
+	}
+	return strings.TrimSpace(buffer.String())
+}
+
+// Render returns the metadata of the journal entry. The renderer isn't safe for
+// concurrent use. A nil renderer returns empty metadata
+func (r *MetadataRenderer) Render(entry JournalEntry) BatchMetadata {
+	if r == nil {
+		return BatchMetadata{}
+	}
+	r.entry = entry
+	defer func() {
+		r.entry = nil
+	}()
+	category := r.category
+	destination := ""
+	for _, route := range r.routes {
+		if route.Matches(entry) {
+			if route.destination != defaultDestination {
+				destination = route.destination
+			}
+			if route.category != nil {
+				category = route.category
+			}
+			break
+		}
+	}
+	if len(r.routes) > 0 {
+		metricRoutedLines.WithLabelValues(cmp.Or(destination, defaultDestination)).Inc()
+	}
+
+	metadata := BatchMetadata{
+		Destination: destination,
+		Category:    r.execute(category),
+		Name:        r.execute(r.name),
+		Host:        r.execute(r.host),
+	}
+	for name, tmpl := range r.fields {
+		if value := r.execute(tmpl); value != "" {
+			if metadata.Fields == nil {
+				metadata.Fields = map[string]string{}
+			}
+			metadata.Fields[name] = value
+		}
+	}
+	return metadata
+}
+
+// Destinations returns the names of the destinations used by the routes
+func (r *MetadataRenderer) Destinations() []string {
+	if r == nil {
+		return nil
+	}
+	return destinationNames(r.routes)
+}
+
+// NewMetadataRenderer creates a renderer from the metadata templates and the routes.
+// It returns nil if neither templates nor routes are set
+func NewMetadataRenderer(category, name, host string, fields map[string]string, routes []string) (*MetadataRenderer, error) {
+	if category == "" && name == "" && host == "" && len(fields) == 0 && len(routes) == 0 {
+		return nil, nil
+	}
+	r := &MetadataRenderer{fields: map[string]*template.Template{}}
+	var err error
+	for _, t := range []struct {
+		what   string
+		text   string
+		target **template.Template
+	}{
+		{"category", category, &r.category},
+		{"name", name, &r.name},
+		{"host", host, &r.host},
+	} {
+		*t.target, err = r.parse(t.what, t.text)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for field, text := range fields {
+		r.fields[field], err = r.parse("field "+field, text)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, spec := range routes {
+		route, err := parseRoute(spec, r.parse)
+		if err != nil {
+			return nil, err
+		}
+		r.routes = append(r.routes, route)
+	}
+	return r, nil
+}
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// canaryMarker tags canary messages, it is followed by the unique ID of the message
+const canaryMarker = "jsumo-canary-id="
+
+// defaultCanaryCommand writes the canary message from stdin to the journal
+const defaultCanaryCommand = "systemd-cat --identifier=jsumo-canary --priority=info"
+
+// canaryVerifyInterval is the interval to search for the uploaded canary message in SumoLogic
+const canaryVerifyInterval = 30 * time.Second
+
+// canaryIDRe extracts the ID of the canary message from a log line
+var canaryIDRe = regexp.MustCompile(regexp.QuoteMeta(canaryMarker) + `([0-9a-f]+)`)
+
+// canaryMessage is a canary message which is tracked through the pipeline
+type canaryMessage struct {
+	writtenAt  time.Time
+	batch      string // Batch file which contains the message
+	uploadedAt time.Time
+	verifying  bool
+}
+
+// CanaryTracker periodically writes a uniquely tagged message into the journal and
+// tracks it through reading, batching and uploading. Optionally, it confirms that the
+// message was ingested using the Search API. All methods are safe to call on a nil
+// tracker, which means that the canary mode is disabled
+type CanaryTracker struct {
+	sync.Mutex
+	messages map[string]*canaryMessage
+	command  string        // Command which writes the message from stdin to the journal
+	verify   bool          // Confirm ingestion using the Search API
+	timeout  time.Duration // Time after which the message is considered lost
+}
+
+// Write writes a new canary message into the journal
+func (c *CanaryTracker) Write() error {
+	if c == nil {
+		return nil
+	}
+	randomBytes := make([]byte, 8)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return err
+	}
+	id := hex.EncodeToString(randomBytes)
+	message := fmt.Sprintf("jsumo canary message %s%s", canaryMarker, id)
+
+	// The message is registered before it is written, as it can be read from the journal
+	// before the command returns
+	c.Lock()
+	c.messages[id] = &canaryMessage{writtenAt: time.Now()}
+	c.Unlock()
+
+	cmd := exec.Command("bash", "-c", c.command)
+	cmd.Stdin = strings.NewReader(message + "\n")
+	Logger.Debug("Writing canary message", "id", id, "command", cmd.String())
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		c.Lock()
+		delete(c.messages, id)
+		c.Unlock()
+		return errors.Join(fmt.Errorf("unable to write canary message: %w", err), errors.New(strings.TrimSpace(string(output))))
+	}
+	return nil
+}
+
+// Find returns the IDs of the canary messages in the log line and records the
+// time they were read from the journal
+func (c *CanaryTracker) Find(line string) []string {
+	if c == nil || !strings.Contains(line, canaryMarker) {
+		return nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	ids := []string{}
+	for _, match := range canaryIDRe.FindAllStringSubmatch(line, -1) {
+		message, ok := c.messages[match[1]]
+		if !ok {
+			// Written by another jsumo instance or before the restart
+			continue
+		}
+		Logger.Debug("Canary message read from the journal", "id", match[1])
+		metricCanaryLatency.WithLabelValues("read").Observe(time.Since(message.writtenAt).Seconds())
+		ids = append(ids, match[1])
+	}
+	return ids
+}
+
+// Batched records the batch file which contains the canary messages
+func (c *CanaryTracker) Batched(ids []string, batch string) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	for _, id := range ids {
+		if message, ok := c.messages[id]; ok {
+			message.batch = batch
+		}
+	}
+}
+
+// Uploaded records that the batch file was uploaded to the receiver. Without the
+// verification, the canary message is successfully delivered at this point
+func (c *CanaryTracker) Uploaded(batch string) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	for id, message := range c.messages {
+		if message.batch != batch || !message.uploadedAt.IsZero() {
+			continue
+		}
+		message.uploadedAt = time.Now()
+		latency := message.uploadedAt.Sub(message.writtenAt)
+		Logger.Debug("Canary message uploaded", "id", id, attrDuration, latency)
+		metricCanaryLatency.WithLabelValues("upload").Observe(latency.Seconds())
+		if !c.verify {
+			c.succeed(id)
+		}
+	}
+}
+
+// succeed marks the canary message as delivered. Must be called with the lock held
+func (c *CanaryTracker) succeed(id string) {
+	delete(c.messages, id)
+	metricCanaryResults.WithLabelValues("success").Inc()
+	metricCanaryLastSuccess.SetToCurrentTime()
+}
+
+// Check verifies the uploaded canary messages using the Search API and fails the
+// messages which weren't delivered within the timeout
+func (c *CanaryTracker) Check(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	for id, message := range c.messages {
+		if time.Since(message.writtenAt) > c.timeout {
+			Logger.Error("Canary message wasn't delivered in time", "id", id, "timeout", c.timeout)
+			delete(c.messages, id)
+			metricCanaryResults.WithLabelValues("failure").Inc()
+			continue
+		}
+		if c.verify && !message.uploadedAt.IsZero() && !message.verifying {
+			message.verifying = true
+			go c.verifyIngestion(ctx, id, message.writtenAt)
+		}
+	}
+}
+
+// verifyIngestion searches for the canary message in SumoLogic until it is found or
+// the timeout is reached
+func (c *CanaryTracker) verifyIngestion(ctx context.Context, id string, writtenAt time.Time) {
+	query := fmt.Sprintf("%q", canaryMarker+id)
+	for time.Since(writtenAt) < c.timeout {
+		found := false
+		err := RunSearch(ctx, query, writtenAt.Add(-5*time.Minute), time.Now().Add(time.Minute), true, 1, func(message SearchMessage) error {
+			found = true
+			return nil
+		})
+		if err != nil {
+			Logger.Error("Unable to verify canary message", "id", id, errAttr(err))
+		}
+		if found {
+			c.Lock()
+			if _, ok := c.messages[id]; ok {
+				latency := time.Since(writtenAt)
+				Logger.Debug("Canary message found in SumoLogic", "id", id, attrDuration, latency)
+				metricCanaryLatency.WithLabelValues("ingest").Observe(latency.Seconds())
+				c.succeed(id)
+			}
+			c.Unlock()
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(canaryVerifyInterval):
+		}
+	}
+}
+
+// Start writes a canary message and checks the pending ones every interval
+func (c *CanaryTracker) Start(ctx context.Context, interval time.Duration) {
+	if c == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	checker := time.NewTicker(canaryVerifyInterval)
+	go func() {
+		defer ticker.Stop()
+		defer checker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.Write(); err != nil {
+					Logger.Error("Unable to write canary message", errAttr(err))
+					metricCanaryResults.WithLabelValues("failure").Inc()
+				}
+			case <-checker.C:
+				c.Check(ctx)
+			}
+		}
+	}()
+}
+
+// NewCanaryTracker creates a new canary tracker. If verify is true, the delivery of
+// the canary messages is confirmed using the Search API
+func NewCanaryTracker(command string, verify bool, timeout time.Duration) *CanaryTracker {
+	if command == "" {
+		command = defaultCanaryCommand
+	}
+	return &CanaryTracker{
+		messages: map[string]*canaryMessage{},
+		command:  command,
+		verify:   verify,
+		timeout:  timeout,
+	}
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	FlagCtlTimeout time.Duration
+	FlagCtlOutput  string
+)
+
+// callAdminAPI sends the request to the admin API of the running jsumo and decodes
+// the response into result
+func callAdminAPI(ctx context.Context, method, endpoint string, result interface{}) error {
+	socket, err := adminSocketPath()
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	ctx, cancel := context.WithTimeout(ctx, FlagCtlTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, "http://jsumo"+endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to connect to jsumo on %s, is it running? %w", socket, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		apiErr := map[string]string{}
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr["error"] == "" {
+			return fmt.Errorf("admin API responded with %s", resp.Status)
+		}
+		return fmt.Errorf("%s", apiErr["error"])
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// ctlCmd groups commands which control the running jsumo
+var ctlCmd = &cobra.Command{
+	Use:   "ctl",
+	Short: "Control the running jsumo",
+	Long: `Control the running jsumo using its admin API. The API is served on a unix socket,
+admin.sock in the working directory by default (see --admin-socket).`,
+}
+
+var ctlPauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Pause uploads, logs are still read and spooled",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		result := map[string]bool{}
+		if err := callAdminAPI(cmd.Context(), http.MethodPost, "/pause", &result); err != nil {
+			return err
+		}
+		fmt.Println("Uploads are paused")
+		return nil
+	},
+}
+
+var ctlResumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Resume uploads",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		result := map[string]bool{}
+		if err := callAdminAPI(cmd.Context(), http.MethodPost, "/resume", &result); err != nil {
+			return err
+		}
+		fmt.Println("Uploads are resumed")
+		return nil
+	},
+}
+
+var ctlFlushCmd = &cobra.Command{
+	Use:   "flush",
+	Short: "Read new logs and upload all queued batch files now",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		result := map[string]int{}
+		if err := callAdminAPI(cmd.Context(), http.MethodPost, "/flush", &result); err != nil {
+			return err
+		}
+		fmt.Println("Logs are flushed")
+		return nil
+	},
+}
+
+var ctlQueueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "List batch files waiting for the upload",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		batches := []StatusBatch{}
+		if err := callAdminAPI(cmd.Context(), http.MethodGet, "/queue", &batches); err != nil {
+			return err
+		}
+		if FlagCtlOutput == "json" {
+			return printJSON(batches)
+		}
+		rows := [][]string{{"FILE", "SIZE", "CREATED", "DESTINATION"}}
+		for _, b := range batches {
+			rows = append(rows, []string{b.File, fmt.Sprint(b.Size), b.CreatedAt.Format(time.RFC3339), b.Destination})
+		}
+		return printTable(rows)
+	},
+}
+
+var ctlDropCmd = &cobra.Command{
+	Use:   "drop",
+	Short: "Remove all queued batch files, their logs are never uploaded",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		if !confirm("Drop all queued batch files? Their logs won't be uploaded") {
+			return nil
+		}
+		result := DropResult{}
+		if err := callAdminAPI(cmd.Context(), http.MethodPost, "/drop", &result); err != nil {
+			return err
+		}
+		fmt.Printf("Dropped %d batch files (%d bytes)\n", result.Files, result.Bytes)
+		return nil
+	},
+}
+
+func init() {
+	ctlCmd.PersistentFlags().DurationVar(&FlagCtlTimeout, "timeout", 5*time.Minute, "time to wait for the running jsumo, e.g. until the queue is flushed")
+	ctlQueueCmd.Flags().StringVarP(&FlagCtlOutput, "output", "o", "table", "output format: table or json")
+	ctlDropCmd.Flags().BoolVarP(&FlagYes, "yes", "y", false, "do not ask for confirmation")
+	ctlCmd.AddCommand(ctlPauseCmd, ctlResumeCmd, ctlFlushCmd, ctlQueueCmd, ctlDropCmd)
+	rootCmd.AddCommand(ctlCmd)
+}
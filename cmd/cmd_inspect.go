@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	FlagInspectPrint      bool
+	FlagInspectMatch      string
+	FlagInspectIgnoreCase bool
+	FlagInspectOutput     string
+)
+
+// batchFilesIn returns the batch files in the directory, in the upload order
+func batchFilesIn(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	filenames := []string{}
+	for _, file := range files {
+		if isBatchFile(file.Name()) {
+			filenames = append(filenames, path.Join(dir, file.Name()))
+		}
+	}
+	// Counters of the batch files have the same number of digits
+	sort.Strings(filenames)
+	return filenames, nil
+}
+
+// formatTimeRange formats the time range of the entries in the batch file
+func formatTimeRange(first, last *time.Time) string {
+	if first == nil || last == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%s - %s (%s)", first.UTC().Format(time.RFC3339), last.UTC().Format(time.RFC3339), last.Sub(*first).Round(time.Second))
+}
+
+// printBatchSummary prints the summary of the batch file as a table
+func printBatchSummary(summary BatchSummary) error {
+	rows := [][]string{
+		{"File:", summary.File},
+		{"Created:", summary.CreatedAt.UTC().Format(time.RFC3339)},
+		{"Entries:", fmt.Sprintf("%d (%d lines)", summary.Entries, summary.Lines)},
+		{"Time range:", formatTimeRange(summary.First, summary.Last)},
+		{"Size:", fmt.Sprintf("%d bytes, %d bytes decompressed (%.2fx)", summary.CompressedSize, summary.DecompressedSize, summary.Ratio())},
+	}
+	metadata := summary.Metadata
+	rows = append(rows, []string{"Destination:", metadata.DestinationName()})
+	if metadata.Category != "" {
+		rows = append(rows, []string{"Category:", metadata.Category})
+	}
+	if metadata.Name != "" {
+		rows = append(rows, []string{"Name:", metadata.Name})
+	}
+	if metadata.Host != "" {
+		rows = append(rows, []string{"Host:", metadata.Host})
+	}
+	if len(metadata.Fields) > 0 {
+		fields := []string{}
+		for name, value := range metadata.Fields {
+			fields = append(fields, name+"="+value)
+		}
+		sort.Strings(fields)
+		rows = append(rows, []string{"Fields:", strings.Join(fields, ",")})
+	}
+	return printTable(rows)
+}
+
+// inspectCmd decodes batch files
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <file|dir>",
+	Short: "Decode batch files",
+	Long: `Decode batch files and show the number of entries, their time range, the compression
+ratio and the metadata. If a directory is given, all batch files in it are inspected.
+With --print, the logs are printed instead. With --match, only entries matching the
+regular expression are printed, prefixed with the name of the file if there are several.`,
+	Example: `  jsumo inspect ~/.local/jsumo
+  jsumo inspect ~/.local/jsumo/batch-1000001.zst.jsumo --print
+  jsumo inspect /var/lib/jsumo --match 'sshd.*Failed' -i`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var match *regexp.Regexp
+		if FlagInspectMatch != "" {
+			pattern := FlagInspectMatch
+			if FlagInspectIgnoreCase {
+				pattern = "(?i)" + pattern
+			}
+			var err error
+			match, err = regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("invalid --match: %w", err)
+			}
+		}
+		cmd.SilenceUsage = true
+
+		filenames := []string{args[0]}
+		info, err := os.Stat(args[0])
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			filenames, err = batchFilesIn(args[0])
+			if err != nil {
+				return err
+			}
+			if len(filenames) == 0 {
+				fmt.Fprintf(os.Stderr, "No batch files in %s\n", args[0])
+				return nil
+			}
+		}
+
+		summaries := []BatchSummary{}
+		for i, filename := range filenames {
+			entries, summary, err := readBatchFile(filename)
+			if err != nil {
+				if os.IsNotExist(err) && len(filenames) > 1 {
+					continue // Uploaded in the meantime
+				}
+				return fmt.Errorf("unable to read %s: %w", filename, err)
+			}
+			switch {
+			case match != nil:
+				for _, entry := range entries {
+					if !match.MatchString(entry) {
+						continue
+					}
+					if len(filenames) > 1 {
+						entry = path.Base(filename) + ": " + entry
+					}
+					fmt.Println(entry)
+				}
+			case FlagInspectPrint:
+				for _, entry := range entries {
+					fmt.Println(entry)
+				}
+			case FlagInspectOutput == "json":
+				summaries = append(summaries, summary)
+			default:
+				if i > 0 {
+					fmt.Println()
+				}
+				if err := printBatchSummary(summary); err != nil {
+					return err
+				}
+			}
+		}
+		if FlagInspectOutput == "json" && match == nil && !FlagInspectPrint {
+			return printJSON(summaries)
+		}
+		return nil
+	},
+}
+
+func init() {
+	inspectCmd.Flags().BoolVarP(&FlagInspectPrint, "print", "p", false, "print the logs of the batch files")
+	inspectCmd.Flags().StringVarP(&FlagInspectMatch, "match", "m", "", "print only entries matching the regular expression")
+	inspectCmd.Flags().BoolVarP(&FlagInspectIgnoreCase, "ignore-case", "i", false, "ignore case in --match")
+	inspectCmd.Flags().StringVarP(&FlagInspectOutput, "output", "o", "table", "output format of the summary: table or json")
+	rootCmd.AddCommand(inspectCmd)
+}
@@ -0,0 +1,337 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	FlagReplaySince     string
+	FlagReplayUntil     string
+	FlagReplayName      string
+	FlagReplayChunk     time.Duration
+	FlagReplayRateLimit int
+	FlagReplayAttempts  int
+)
+
+// replayDirPrefix is the prefix of the working directories of replays, they are created
+// in the working directory of jsumo
+const replayDirPrefix = "replay-"
+
+// replayStateFilename is the file with the progress of the replay
+const replayStateFilename = "replay.json"
+
+// replayNameRe matches valid names of replays
+var replayNameRe = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// ReplayState is the progress of the replay, it is stored in the working directory of
+// the replay so the replay can be resumed
+type ReplayState struct {
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+	Grep     string    `json:"grep,omitempty"`
+	Position time.Time `json:"position"` // Logs before this time were replayed
+	Batches  int       `json:"batches"`
+	Bytes    int64     `json:"bytes"`
+}
+
+// Replay resends logs of a time window from the journal. It has its own cursor, batch
+// files and receiver, the cursor and the receivers of jsumo aren't touched
+type Replay struct {
+	name          string
+	dir           string
+	state         ReplayState
+	reader        *JournalReader
+	receiver      string // Receiver URL of the default destination
+	chunk         time.Duration
+	rateLimit     int // Bytes per second, 0 means no limit
+	attempts      int // Failed uploads of a batch file before the replay stops
+	retryInterval time.Duration
+}
+
+// saveState stores the progress of the replay
+func (r *Replay) saveState() error {
+	data, err := json.MarshalIndent(r.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(r.dir, replayStateFilename), data, 0644)
+}
+
+// uploadNext uploads the next batch file in the queue and returns its size. The batch
+// files of the default destination are sent to the receiver of the replay, so it isn't
+// resolved again and the cached receiver URL isn't written when it rejects uploads
+func (r *Replay) uploadNext(ctx context.Context) (int64, error) {
+	filename := UploadQueue.Next()
+	if filename == "" {
+		return 0, nil
+	}
+	var size int64
+	if info, err := os.Stat(filename); err == nil {
+		size = info.Size()
+	}
+	receiverURL, ok := namedReceiverURL(filename)
+	if !ok {
+		receiverURL = r.receiver
+	}
+	err := uploadFileToSumoSource(ctx, filename, receiverURL)
+	if err != nil {
+		UploadQueue.ReturnFile(filename)
+		return 0, err
+	}
+	return size, nil
+}
+
+// upload uploads all queued batch files. Failed uploads are retried every upload interval,
+// the replay stops after the given number of failed attempts to upload the same batch
+// file. Uploads are throttled to the rate limit
+func (r *Replay) upload(ctx context.Context) error {
+	failures := 0
+	for UploadQueue.Len() > 0 {
+		startedAt := time.Now()
+		size, err := r.uploadNext(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			failures++
+			if failures >= r.attempts {
+				return fmt.Errorf("upload failed %d times, %d files are left in the queue: %w", failures, UploadQueue.Len(), err)
+			}
+			Logger.Warn("Upload failed, retrying", "in", r.retryInterval, errAttr(err))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(r.retryInterval):
+			}
+			continue
+		}
+		failures = 0
+		r.state.Batches++
+		r.state.Bytes += size
+		if r.rateLimit > 0 {
+			wait := time.Duration(float64(size)/float64(r.rateLimit)*float64(time.Second)) - time.Since(startedAt)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+	}
+	return nil
+}
+
+// Run replays the logs chunk by chunk: the logs of the chunk are read, batched as by the
+// daemon and uploaded before the next chunk is read. The progress is saved after every
+// chunk, so an interrupted replay continues from the last chunk
+func (r *Replay) Run(ctx context.Context) error {
+	// Batch files left by the interrupted replay are uploaded first
+	if !r.reader.shouldReadNewLogs() {
+		Logger.Info("Uploading batch files left by the interrupted replay...", attrQueue, UploadQueue.Len())
+		if err := r.upload(ctx); err != nil {
+			return err
+		}
+	}
+	for r.state.Position.Before(r.state.Until) {
+		chunkEnd := r.state.Position.Add(r.chunk)
+		if chunkEnd.After(r.state.Until) {
+			chunkEnd = r.state.Until
+		}
+		r.reader.until = chunkEnd
+		if err := r.reader.ReadLogs(ctx); err != nil {
+			return err
+		}
+		if err := r.upload(ctx); err != nil {
+			return err
+		}
+		r.state.Position = chunkEnd
+		if err := r.saveState(); err != nil {
+			return err
+		}
+		progress := float64(chunkEnd.Sub(r.state.Since)) / float64(r.state.Until.Sub(r.state.Since)) * 100
+		Logger.Info("Replayed logs",
+			"replay", r.name,
+			"until", chunkEnd.UTC(),
+			"progress", fmt.Sprintf("%.0f%%", progress),
+			"batches", r.state.Batches,
+			attrBytes, r.state.Bytes,
+		)
+	}
+	return nil
+}
+
+// NewReplay creates the replay of the time window or resumes the replay with the same
+// name. The name defaults to the time window
+func NewReplay(name string, since, until time.Time, chunk time.Duration, rateLimit, attempts int) (*Replay, error) {
+	if name == "" {
+		name = fmt.Sprintf("%s-%s", since.UTC().Format("20060102T150405Z"), until.UTC().Format("20060102T150405Z"))
+	}
+	if !replayNameRe.MatchString(name) {
+		return nil, fmt.Errorf("invalid replay name %q, only letters, digits, '.', '_' and '-' are allowed", name)
+	}
+	stateDir, err := getStateDir()
+	if err != nil {
+		return nil, err
+	}
+	r := &Replay{
+		name:          name,
+		dir:           path.Join(stateDir, replayDirPrefix+name),
+		chunk:         chunk,
+		rateLimit:     rateLimit,
+		attempts:      attempts,
+		retryInterval: CurrentSettings().UploadInterval,
+		state:         ReplayState{Since: since, Until: until, Grep: FlagGrep, Position: since},
+	}
+
+	data, err := os.ReadFile(path.Join(r.dir, replayStateFilename))
+	switch {
+	case err == nil:
+		// The window of the interrupted replay is kept, e.g. if it was given relative to now
+		if err := json.Unmarshal(data, &r.state); err != nil {
+			return nil, fmt.Errorf("invalid state of replay %s: %w", name, err)
+		}
+		if r.state.Grep != FlagGrep {
+			return nil, fmt.Errorf("replay %s was started with --grep %q, use the same filter or another --name", name, r.state.Grep)
+		}
+		Logger.Warn("Resuming replay", "replay", name, "from", r.state.Position.UTC())
+	case errors.Is(err, os.ErrNotExist):
+		if err := os.MkdirAll(r.dir, 0755); err != nil {
+			return nil, err
+		}
+		if err := r.saveState(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	r.reader, err = newJournalReader(r.dir, r.state.Since)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// replayReceiverURL returns the receiver URL for the replay: --url, SUMO_RECEIVER_URL
+// credential, the cached receiver URL or the one resolved using SumoLogic API. The
+// resolved URL isn't cached, the cache belongs to the daemon
+func replayReceiverURL(ctx context.Context) (string, error) {
+	if FlagReceiver != "" {
+		return FlagReceiver, nil
+	}
+	found, err := Credentials.Has(sumoReceiverURLCredential)
+	if err != nil {
+		return "", err
+	}
+	if found {
+		return Credentials.Get(sumoReceiverURLCredential)
+	}
+	cachedURL, err := readCachedReceiverURL()
+	if err != nil {
+		return "", err
+	}
+	if cachedURL != "" {
+		return cachedURL, nil
+	}
+	haveCredentials, err := haveSumoCredentials()
+	if err != nil {
+		return "", err
+	}
+	if !haveCredentials {
+		return "", fmt.Errorf("receiver URL is empty and SumoLogic API credentials are not set")
+	}
+	return GetReceiverURL(ctx)
+}
+
+// replayCmd resends the logs of a time window
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Resend logs of a time window from the journal",
+	Long: `Resend logs of a time window from the journal, e.g. after the receiver was misconfigured.
+The logs are read, filtered (--grep), routed and batched as by jsumo itself and sent to
+the receiver (--url, SUMO_RECEIVER_URL credential or the receiver of jsumo). The replay
+has its own cursor in the working directory, the cursor of jsumo isn't touched.
+
+The window is read in chunks (--chunk). If the replay is interrupted, run the same command
+again to resume it. If the window is given relative to now, use --name to resume it. The
+replay also stops after --attempts failed uploads of a batch file and is resumed the same way.`,
+	Example: `  jsumo replay --since 2025-01-01T00:00:00Z --until 2025-01-02T00:00:00Z
+  jsumo replay --since 6h --until 1h --name outage --rate-limit 100000 --grep sshd`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		now := time.Now()
+		since, err := parseSearchTime(FlagReplaySince, now)
+		if err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+		until, err := parseSearchTime(FlagReplayUntil, now)
+		if err != nil {
+			return fmt.Errorf("invalid --until: %w", err)
+		}
+		if !since.Before(until) {
+			return fmt.Errorf("--since must be before --until")
+		}
+		if FlagReplayChunk <= 0 {
+			return fmt.Errorf("--chunk must be positive")
+		}
+		if FlagReplayAttempts < 1 {
+			return fmt.Errorf("--attempts must be at least 1")
+		}
+		cmd.SilenceUsage = true
+		ctx := cmd.Context()
+		UploadQueue = Queue{}
+
+		replay, err := NewReplay(FlagReplayName, since, until, FlagReplayChunk, FlagReplayRateLimit, FlagReplayAttempts)
+		if err != nil {
+			return err
+		}
+		receiverURL, err := replayReceiverURL(ctx)
+		if err != nil {
+			return err
+		}
+		replay.receiver = receiverURL
+		destinations, err := resolveDestinations(replay.reader.metadata.Destinations(), FlagDestinations)
+		if err != nil {
+			return err
+		}
+		setDestinations(destinations)
+
+		Logger.Info("Replaying logs",
+			"replay", replay.name,
+			"since", replay.state.Since.UTC(),
+			"until", replay.state.Until.UTC(),
+			attrReceiver, redactReceiverURL(receiverURL),
+		)
+		err = replay.Run(ctx)
+		if ctx.Err() != nil {
+			return fmt.Errorf("replay %s interrupted, run the same command to resume it", replay.name)
+		}
+		if err != nil {
+			return fmt.Errorf("replay %s stopped, run the same command to resume it: %w", replay.name, err)
+		}
+		if err := os.RemoveAll(replay.dir); err != nil {
+			return err
+		}
+		Logger.Info("Replay complete", "replay", replay.name, "batches", replay.state.Batches, attrBytes, replay.state.Bytes)
+		return nil
+	},
+}
+
+func init() {
+	replayCmd.Flags().StringVar(&FlagReplaySince, "since", "", "start of the time window, a duration before now or a RFC3339 timestamp")
+	replayCmd.Flags().StringVar(&FlagReplayUntil, "until", "now", "end of the time window, a duration before now or a RFC3339 timestamp")
+	replayCmd.Flags().StringVar(&FlagReplayName, "name", "", "name of the replay, used to resume it. Defaults to the time window")
+	replayCmd.Flags().DurationVar(&FlagReplayChunk, "chunk", 10*time.Minute, "the window is read and uploaded in chunks of this duration")
+	replayCmd.Flags().IntVar(&FlagReplayRateLimit, "rate-limit", 0, "maximum number of bytes sent to the receiver per second, 0 means no limit")
+	replayCmd.Flags().IntVar(&FlagReplayAttempts, "attempts", 10, "the replay stops after this number of failed attempts to upload a batch file, it can be resumed later")
+	replayCmd.MarkFlagRequired("since")
+	rootCmd.AddCommand(replayCmd)
+}
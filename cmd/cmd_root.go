@@ -4,30 +4,89 @@ Copyright © 2025 YAUHEN SHULITSKI
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
+	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 )
 
 var (
-	Version            = "dev"
-	Logger             *log.Logger
-	DebugLogger        *log.Logger
-	UploadQueue        Queue
-	FlagVersion        bool
-	FlagDebug          bool
-	FlagReceiver       string
-	FlagReadInterval   time.Duration
-	FlagUploadInterval time.Duration
-	FlagSourceCategory string
-	FlagGrep           string
+	Version             = "dev"
+	Logger              *slog.Logger
+	UploadQueue         Queue
+	Receivers           *ReceiverPool
+	Credentials         *CredentialChain
+	SumoAPI             *SumoClient
+	Canary              *CanaryTracker
+	Metrics             *MetricsForwarder
+	Systemd             *SystemdNotifier
+	Health              *HealthTracker
+	Admin               *AdminController
+	DryRun              *DryRunWriter
+	Destinations        map[string]string // Receiver URLs of the named destinations
+	FlagVersion         bool
+	FlagConfig          string
+	FlagDebug           bool
+	FlagLogFormat       string
+	FlagLogLevel        string
+	FlagReceiver        string
+	FlagReadInterval    time.Duration
+	FlagUploadInterval  time.Duration
+	FlagShutdownTimeout time.Duration
+	FlagListen          string
+	FlagAdminSocket     string
+	FlagStateDir        string
+	FlagReadyUploadAge  time.Duration
+	FlagSourceCategory  string
+	FlagSumoName        string
+	FlagSumoHost        string
+	FlagSumoFields      map[string]string
+	FlagRoutes          []string
+	FlagDestinations    map[string]string
+	FlagGrep            string
+	FlagFailoverURLs    []string
+	FlagFailoverAfter   int
+	FlagProbeInterval   time.Duration
+	FlagSumoDeployment  string
+	FlagSumoAPIURL      string
+	FlagPlan            bool
+	FlagDryRun          string
+	FlagOnce            bool
+	FlagCredsHelper     string
+
+	FlagCanaryInterval time.Duration
+	FlagCanaryCommand  string
+	FlagCanaryVerify   bool
+	FlagCanaryTimeout  time.Duration
+
+	FlagMetricsInterval   time.Duration
+	FlagMetricsURL        string
+	FlagMetricsFormat     string
+	FlagMetricsNode       bool
+	FlagMetricsSourceName string
+
+	FlagCollectorName         string
+	FlagSourceName            string
+	FlagSourceHost            string
+	FlagTemplateVars          map[string]string
+	FlagCollectorDescription  string
+	FlagCollectorCategory     string
+	FlagCollectorTimezone     string
+	FlagCollectorFields       map[string]string
+	FlagSourceDescription     string
+	FlagSourceCategoryName    string
+	FlagSourceTimezone        string
+	FlagSourceFields          map[string]string
+	FlagSourceMultiline       bool
+	FlagSourceMultilineRegex  string
+	FlagSourceAutoDateParsing bool
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -35,115 +94,294 @@ var rootCmd = &cobra.Command{
 	Use:   "jsumo",
 	Short: "jsumo is a tool to quickly forward your logs from journalctl to SumoLogic",
 	Long:  `jsumo is a tool to quickly forward your logs from journalctl to SumoLogic. It uses journalctl cursor to ensure that no logs are lost.`,
+	// The logger is shared by all subcommands
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Settings from the configuration file are applied before the loggers are
+		// created, so the debug mode can be enabled in the file
+		if FlagConfig != "" {
+			if err := LoadConfig(cmd, FlagConfig); err != nil {
+				return err
+			}
+		}
+		recordExplicitSettings(cmd.Flags())
+		if err := checkOutputFormat(cmd.Flags()); err != nil {
+			return err
+		}
+		if err := setupLogger(os.Stdout); err != nil {
+			return err
+		}
+		Credentials = NewCredentialChain(FlagCredsHelper)
+		SumoAPI = NewSumoClient(Credentials)
+		return nil
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cmd.SilenceUsage = true
 
-		Logger = log.New(os.Stdout, "", log.Lmicroseconds|log.Lshortfile)
 		UploadQueue = Queue{}
+		Health = NewHealthTracker()
 
 		// Handle flags
-		if FlagDebug {
-			DebugLogger = log.New(os.Stdout, "", log.Lmicroseconds|log.Lshortfile)
-		} else {
-			DebugLogger = log.New(io.Discard, "", 0)
-		}
-
 		if FlagVersion {
 			fmt.Println(Version)
 			return nil
 		}
-
-		http.Handle("/metrics", promhttp.Handler())
-		go func() {
-			err := http.ListenAndServe(":2112", nil)
+		if FlagCanaryInterval > 0 && FlagCanaryVerify {
+			haveCredentials, err := haveSumoCredentials()
 			if err != nil {
-				Logger.Println(red(err))
+				return err
 			}
-		}()
+			if !haveCredentials {
+				return fmt.Errorf("--canary-verify requires SumoLogic API credentials")
+			}
+		}
 
-		// Get the receiver URL
+		ctx := cmd.Context()
+		if FlagPlan {
+			return PlanSumo(ctx)
+		}
+		if FlagDryRun != "" {
+			return runDryRun(ctx)
+		}
+
+		// Get the receiver URL. When it is provisioned automatically, jsumo starts
+		// with the cached URL and resolves it in the background, so logs are read
+		// and spooled even if SumoLogic API is not reachable
+		receiverFromCredentials := false
 		if FlagReceiver == "" {
-			Logger.Printf("Initializing jsumo %s...\n", Version)
-			receiverURL, err := GetReceiverURL()
+			found, err := Credentials.Has(sumoReceiverURLCredential)
 			if err != nil {
 				return err
 			}
-			FlagReceiver = receiverURL
+			if found {
+				FlagReceiver, _ = Credentials.Get(sumoReceiverURLCredential)
+				receiverFromCredentials = true
+			}
 		}
-		if FlagReceiver == "" {
-			return fmt.Errorf("receiver URL is empty")
+		autoProvisioned := FlagReceiver == ""
+		primaryURL := FlagReceiver
+		if autoProvisioned {
+			Logger.Info("Initializing jsumo...", "version", Version)
+			cachedURL, err := readCachedReceiverURL()
+			if err != nil {
+				Logger.Error("Unable to read cached receiver URL", errAttr(err))
+			}
+			primaryURL = cachedURL
+		}
+
+		resolvable := false
+		if autoProvisioned {
+			haveCredentials, err := haveSumoCredentials()
+			switch {
+			case err != nil && primaryURL == "":
+				return err
+			case err != nil:
+				// Logs are sent to the cached receiver URL, which isn't resolved again
+				Logger.Error("Unable to read SumoLogic API credentials", errAttr(err))
+			case !haveCredentials && primaryURL == "":
+				return fmt.Errorf("receiver URL is empty and SumoLogic API credentials are not set")
+			}
+			resolvable = haveCredentials
+		}
+
+		// A single run can't wait for the provisioning in the background, so the
+		// receiver URL is resolved before the logs are read
+		if FlagOnce && resolvable && primaryURL == "" {
+			url, err := resolveReceiverURL(ctx)
+			if err != nil {
+				return err
+			}
+			primaryURL = url
+		}
+
+		// Metrics are forwarded to a separate source, which is provisioned together
+		// with the logs source unless its URL is given
+		if FlagMetricsInterval > 0 && !FlagOnce {
+			if FlagMetricsURL == "" && !resolvable {
+				return fmt.Errorf("--metrics-url is required when the receiver URL is not provisioned automatically")
+			}
+			forwarder, err := NewMetricsForwarder(FlagMetricsURL, FlagMetricsFormat, FlagMetricsNode)
+			if err != nil {
+				return err
+			}
+			Metrics = forwarder
+			Metrics.Start(ctx, FlagMetricsInterval)
+			Logger.Info("Metrics are forwarded", attrInterval, FlagMetricsInterval)
+		}
+
+		// Readiness is reported to systemd when a usable receiver URL is known, e.g. the
+		// cached one. Otherwise the notification is sent when it is resolved
+		Systemd = NewSystemdNotifier()
+		Receivers = NewReceiverPool(append([]string{primaryURL}, FlagFailoverURLs...), FlagFailoverAfter)
+		Receivers.Resolvable = resolvable
+		if Receivers.Current() != "" || !Receivers.Resolvable || FlagOnce {
+			Systemd.Ready()
+		}
+		if Receivers.Resolvable && !FlagOnce {
+			Receivers.ProvisionPrimary(ctx)
+		}
+		if len(FlagFailoverURLs) > 0 {
+			Logger.Info("Failover receivers configured", "receivers", len(FlagFailoverURLs))
+			Receivers.StartProbing(ctx, FlagProbeInterval)
+		}
+		if Receivers.Current() == "" {
+			Logger.Warn("Receiver URL is not resolved yet, logs are spooled until it is available")
+		} else {
+			Logger.Info("Initialization complete. Ready to forward journalctl logs", attrReceiver, redactReceiverURL(Receivers.Current()))
 		}
-		Logger.Printf("Initialization complete. Ready to forward journalctl logs to %s\n", FlagReceiver)
 
 		journalReader, err := NewJournalReader()
 		if err != nil {
 			return err
 		}
+		destinations, err := resolveDestinations(journalReader.metadata.Destinations(), FlagDestinations)
+		if err != nil {
+			return err
+		}
+		setDestinations(destinations)
+
+		if FlagOnce {
+			return runOnce(ctx, journalReader)
+		}
 
-		// Start reading logs from journalctl every 5 seconds
+		if FlagListen != "" {
+			server, err := StartHTTPServer(FlagListen, journalReader.workingDir)
+			if err != nil {
+				return err
+			}
+			defer server.Close()
+		}
+
+		// Uploads can be paused and the queue flushed or dropped using the admin API
+		Admin = NewAdminController(journalReader)
+		adminSocket, err := adminSocketPath()
+		if err != nil {
+			return err
+		}
+		adminServer, err := StartAdminServer(adminSocket, Admin)
+		if err != nil {
+			return err
+		}
+		defer adminServer.Close()
+
+		// Uploads outlive the cancellation of ctx by the shutdown timeout, so the queued
+		// batch files are flushed before exiting
+		uploadCtx, cancelUploads := context.WithCancel(context.WithoutCancel(ctx))
+		defer cancelUploads()
+		var wg sync.WaitGroup
+
+		// Write canary messages to verify the delivery of logs end to end. The tracker is
+		// created before the reader and the uploader, which look up canary messages
+		if FlagCanaryInterval > 0 {
+			Canary = NewCanaryTracker(FlagCanaryCommand, FlagCanaryVerify, FlagCanaryTimeout)
+			Canary.Start(ctx, FlagCanaryInterval)
+			Logger.Info("Canary messages are written", attrInterval, FlagCanaryInterval)
+		}
+
+		// The watchdog is pinged only while the reader and the uploader are alive
+		Health.Expect("reader", FlagReadInterval)
+		Health.Expect("uploader", FlagUploadInterval)
+		Systemd.Start(ctx)
+
+		// Start reading logs from journalctl every read interval
 		tickerJournal := time.NewTicker(FlagReadInterval)
-		logReadIsActive := false
+		wg.Add(1)
 		go func() {
-			for ; ; <-tickerJournal.C {
-				logReadIsActive = true
-				err := journalReader.ReadLogs()
-				if err != nil {
-					Logger.Println(red(err))
+			defer wg.Done()
+			for {
+				err := journalReader.ReadLogs(ctx)
+				if err != nil && ctx.Err() == nil {
+					Logger.Error("Unable to read logs", errAttr(err))
+					Health.ReportError(err)
+				}
+				Health.Heartbeat("reader")
+				select {
+				case <-ctx.Done():
+					return
+				case <-tickerJournal.C:
+				case task := <-Admin.readerTasks:
+					task(ctx)
 				}
-				logReadIsActive = false
 			}
 		}()
 
-		// Start uploading files to SumoLogic
+		// Start uploading files to SumoLogic. On shutdown, the uploader flushes the
+		// queue after the reader has stopped
 		tickerUploader := time.NewTicker(FlagUploadInterval)
-		uploaderIsActive := false
+		wg.Add(1)
 		go func() {
-			for ; ; <-tickerUploader.C {
-				uploaderIsActive = true
-				fileToUpload := UploadQueue.Next()
-				if fileToUpload != "" {
-					err := uploadFileToSumoSource(fileToUpload, FlagReceiver)
+			defer wg.Done()
+			for {
+				if Admin.Paused() {
+					Logger.Debug("Uploads are paused, skipping upload")
+				} else {
+					// Failed uploads are logged by uploadNextBatch
+					err := uploadNextBatch(uploadCtx)
+					if errors.Is(err, errReceiverNotResolved) {
+						Logger.Debug("Receiver URL is not resolved yet, skipping upload")
+					}
+				}
+				Health.Heartbeat("uploader")
+				select {
+				case <-ctx.Done():
+					return
+				case <-tickerUploader.C:
+				case task := <-Admin.uploaderTasks:
+					task(uploadCtx)
+				}
+			}
+		}()
+
+		// Reload credentials and the configuration file on SIGHUP
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		go func() {
+			for range hup {
+				Credentials.Reload()
+				if FlagConfig != "" {
+					err := ReloadConfig(cmd, FlagConfig, journalReader, tickerJournal, tickerUploader)
+					if err != nil {
+						Logger.Error("Configuration wasn't reloaded", errAttr(err))
+					}
+				}
+				if receiverFromCredentials {
+					receiverURL, err := Credentials.Get(sumoReceiverURLCredential)
 					if err != nil {
-						metricErrorsWhenSendingToReceiver.Inc()
-						Logger.Println(red(err))
-						UploadQueue.ReturnFile(fileToUpload)
+						Logger.Error("Unable to read the receiver URL", errAttr(err))
 						continue
 					}
-				} else {
-					DebugLogger.Println("No files to upload")
+					Receivers.SetPrimary(receiverURL)
 				}
-				uploaderIsActive = false
 			}
 		}()
 
-		// Handle graceful shutdown on Ctrl+C or SIGINT signal
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt)
-		<-c
-		Logger.Println(yellow("Shutting down gracefully..."))
+		// Handle graceful shutdown on Ctrl+C or SIGTERM, ctx is cancelled by the signal
+		<-ctx.Done()
+		Logger.Warn("Shutting down gracefully...")
+		Systemd.Stopping()
 		tickerJournal.Stop()
 		tickerUploader.Stop()
 
-		timeout := time.After(30 * time.Second)
 		shutdownComplete := make(chan struct{})
-
 		go func() {
-			for logReadIsActive {
-				Logger.Println(yellow("Waiting for log reading to finish..."))
-				time.Sleep(1 * time.Second)
+			wg.Wait()
+			// Paused uploads stay paused, the queue is uploaded after the restart
+			if !Admin.Paused() {
+				flushUploadQueue(uploadCtx, CurrentSettings().UploadInterval)
 			}
-			for uploaderIsActive {
-				Logger.Println(yellow("Waiting for file upload to finish..."))
-				time.Sleep(1 * time.Second)
-			}
-			shutdownComplete <- struct{}{}
+			close(shutdownComplete)
 		}()
 
 		select {
 		case <-shutdownComplete:
-			Logger.Println("Shutdown complete.")
-		case <-timeout:
-			Logger.Println(red("Shutdown timed out. Exiting immediately."))
+			if UploadQueue.Len() > 0 {
+				Logger.Warn("Shutdown complete, files are left in the queue", attrQueue, UploadQueue.Len())
+			} else {
+				Logger.Info("Shutdown complete.")
+			}
+		case <-time.After(FlagShutdownTimeout):
+			cancelUploads()
+			Logger.Error("Shutdown timed out. Exiting immediately.")
 		}
 		return nil
 	},
@@ -152,7 +390,10 @@ var rootCmd = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
+	// Commands are cancelled on Ctrl+C and on SIGTERM, which is sent by systemd
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
 	if err != nil {
 		os.Exit(1)
 	}
@@ -161,9 +402,56 @@ func Execute() {
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&FlagVersion, "version", "v", false, "print version and exit")
 	rootCmd.PersistentFlags().BoolVarP(&FlagDebug, "debug", "d", false, "enable debug mode")
-	rootCmd.PersistentFlags().StringVarP(&FlagReceiver, "url", "r", "", "receiver URL. If empty, it will be fetched or created automatically using SumoLogic API")
+	rootCmd.PersistentFlags().StringVar(&FlagLogFormat, "log-format", "text", "format of the logs of jsumo: text or json. Text is coloured on a terminal unless NO_COLOR is set")
+	rootCmd.PersistentFlags().StringVar(&FlagLogLevel, "log-level", "info", "minimum level of the logs of jsumo: debug, info, warn or error. --debug sets it to debug")
+	rootCmd.PersistentFlags().StringVar(&FlagListen, "listen", "127.0.0.1:2112", "address of the metrics, health and status endpoints, e.g. :2112 to listen on all interfaces or unix:/run/jsumo/http.sock. Empty disables them")
+	rootCmd.PersistentFlags().DurationVar(&FlagReadyUploadAge, "ready-upload-age", 5*time.Minute, "/readyz fails if batch files are waiting and nothing was uploaded for this time")
+	rootCmd.PersistentFlags().StringVar(&FlagStateDir, "state-dir", "", "working directory with the cursor and the batch files. Defaults to $STATE_DIRECTORY set by systemd or ~/.local/jsumo")
+	rootCmd.PersistentFlags().StringVar(&FlagAdminSocket, "admin-socket", "", "unix socket of the admin API used by jsumo ctl, defaults to admin.sock in the working directory")
+	rootCmd.PersistentFlags().StringVar(&FlagConfig, "config", "", "YAML configuration file, its keys are the names of the flags. Flags override the file")
+	rootCmd.PersistentFlags().StringVarP(&FlagReceiver, "url", "r", "", "receiver URL. If empty, it is read from SUMO_RECEIVER_URL credential or fetched or created automatically using SumoLogic API")
 	rootCmd.PersistentFlags().DurationVar(&FlagReadInterval, "read-interval", 5*time.Second, "interval to read logs from journalctl")
 	rootCmd.PersistentFlags().DurationVar(&FlagUploadInterval, "upload-interval", 2*time.Second, "interval to upload files to the receiver URL")
-	rootCmd.PersistentFlags().StringVarP(&FlagSourceCategory, "category", "c", "", "override source category with the given value")
+	rootCmd.PersistentFlags().DurationVar(&FlagShutdownTimeout, "shutdown-timeout", 30*time.Second, "time to finish reading logs and flush the upload queue on shutdown")
+	rootCmd.PersistentFlags().StringVarP(&FlagSourceCategory, "category", "c", "", "override source category of the logs, a template over journal fields, e.g. prod/{{unit}}")
+	rootCmd.PersistentFlags().StringArrayVar(&FlagRoutes, "route", nil, "route matching logs to a destination, e.g. \"unit=sshd.service;destination=security;category=security/{{unit}}\". Keys: unit, identifier, priority, message, destination, category. The first matching route is used")
+	rootCmd.PersistentFlags().StringToStringVar(&FlagDestinations, "destination", nil, "receiver URLs of the destinations used in routes, e.g. security=https://... Also read from SUMO_RECEIVER_URL_<NAME> credentials")
+	rootCmd.PersistentFlags().StringVar(&FlagSumoName, "name", "", "override source name of the logs, a template over journal fields, e.g. {{identifier}}")
+	rootCmd.PersistentFlags().StringVar(&FlagSumoHost, "host", "", "override source host of the logs, a template over journal fields, e.g. {{hostname}}")
+	rootCmd.PersistentFlags().StringToStringVar(&FlagSumoFields, "fields", nil, "fields of the logs, templates over journal fields, e.g. unit={{unit}},priority={{priority}}")
 	rootCmd.PersistentFlags().StringVarP(&FlagGrep, "grep", "g", "", "pass grep pattern to journalctl command")
+	rootCmd.PersistentFlags().StringVar(&FlagCredsHelper, "credentials-helper", "", "command which prints credentials as a JSON object, e.g. {\"SUMO_ACCESSID\": \"...\", \"SUMO_ACCESSKEY\": \"...\"}")
+	rootCmd.PersistentFlags().StringVar(&FlagSumoDeployment, "sumo-deployment", "de", "SumoLogic deployment of the account: us1, us2, eu, de, au, jp, ca, in or fed")
+	rootCmd.PersistentFlags().StringVar(&FlagSumoAPIURL, "sumo-api-url", "", "override SumoLogic REST API URL, e.g. https://api.sumologic.com/api/v1")
+	rootCmd.PersistentFlags().StringVar(&FlagDryRun, "dry-run", "", "read, filter and batch logs but write them to stdout (--dry-run) or to a directory (--dry-run=DIR) instead of uploading. The cursor isn't moved")
+	rootCmd.PersistentFlags().Lookup("dry-run").NoOptDefVal = dryRunStdout
+	rootCmd.PersistentFlags().BoolVar(&FlagOnce, "once", false, "read new logs and upload them once, then exit, e.g. for cron")
+	rootCmd.PersistentFlags().BoolVar(&FlagPlan, "plan", false, "print the changes which would be made to the collector and the source in SumoLogic and exit")
+	rootCmd.PersistentFlags().StringVar(&FlagCollectorName, "collector-name", defaultNameTemplate, "template of the collector name in SumoLogic, e.g. {{.Vars.role}}-{{env \"ENVIRONMENT\"}}")
+	rootCmd.PersistentFlags().StringVar(&FlagSourceName, "source-name", defaultNameTemplate, "template of the HTTP source name in SumoLogic")
+	rootCmd.PersistentFlags().StringVar(&FlagSourceHost, "source-host", defaultNameTemplate, "template of the host name of the HTTP source in SumoLogic")
+	rootCmd.PersistentFlags().StringToStringVar(&FlagTemplateVars, "template-var", nil, "variables available in the naming templates as {{.Vars.name}}, e.g. role=web")
+	rootCmd.PersistentFlags().StringVar(&FlagCollectorDescription, "collector-description", "Created by jsumo", "description of the collector in SumoLogic")
+	rootCmd.PersistentFlags().StringVar(&FlagCollectorCategory, "collector-category", "", "category of the collector in SumoLogic")
+	rootCmd.PersistentFlags().StringVar(&FlagCollectorTimezone, "collector-timezone", "", "time zone of the collector in SumoLogic, e.g. Etc/UTC")
+	rootCmd.PersistentFlags().StringToStringVar(&FlagCollectorFields, "collector-fields", nil, "fields of the collector in SumoLogic, e.g. env=prod,team=ops")
+	rootCmd.PersistentFlags().StringVar(&FlagSourceDescription, "source-description", "Created by jsumo", "description of the HTTP source in SumoLogic")
+	rootCmd.PersistentFlags().StringVar(&FlagSourceCategoryName, "source-category", defaultNameTemplate, "template of the category of the HTTP source in SumoLogic")
+	rootCmd.PersistentFlags().StringVar(&FlagSourceTimezone, "source-timezone", "", "time zone of the HTTP source in SumoLogic, e.g. Etc/UTC")
+	rootCmd.PersistentFlags().StringToStringVar(&FlagSourceFields, "source-fields", nil, "fields of the HTTP source in SumoLogic, e.g. env=prod,team=ops")
+	rootCmd.PersistentFlags().BoolVar(&FlagSourceMultiline, "source-multiline", true, "enable multiline processing in the HTTP source")
+	rootCmd.PersistentFlags().StringVar(&FlagSourceMultilineRegex, "source-multiline-regex", "", "regular expression matching the first line of a multiline message. If empty, boundaries are detected automatically")
+	rootCmd.PersistentFlags().BoolVar(&FlagSourceAutoDateParsing, "source-auto-date-parsing", true, "enable automatic date parsing in the HTTP source")
+	rootCmd.PersistentFlags().DurationVar(&FlagCanaryInterval, "canary-interval", 0, "interval to write a canary message to the journal and track its delivery, 0 disables canary mode")
+	rootCmd.PersistentFlags().StringVar(&FlagCanaryCommand, "canary-command", defaultCanaryCommand, "command which writes the canary message from stdin to the journal")
+	rootCmd.PersistentFlags().BoolVar(&FlagCanaryVerify, "canary-verify", false, "confirm that canary messages were ingested using SumoLogic Search API")
+	rootCmd.PersistentFlags().DurationVar(&FlagCanaryTimeout, "canary-timeout", 10*time.Minute, "time after which an undelivered canary message is considered lost")
+	rootCmd.PersistentFlags().DurationVar(&FlagMetricsInterval, "metrics-interval", 0, "interval to forward jsumo metrics to SumoLogic, 0 disables forwarding of metrics")
+	rootCmd.PersistentFlags().StringVar(&FlagMetricsURL, "metrics-url", "", "receiver URL of the HTTP source for metrics. If empty, the source is provisioned together with the logs source")
+	rootCmd.PersistentFlags().StringVar(&FlagMetricsFormat, "metrics-format", "prometheus", "format of forwarded metrics: prometheus or carbon2")
+	rootCmd.PersistentFlags().BoolVar(&FlagMetricsNode, "metrics-node", false, "forward host stats (load, memory, CPU) from /proc together with jsumo metrics")
+	rootCmd.PersistentFlags().StringVar(&FlagMetricsSourceName, "metrics-source-name", defaultNameTemplate+"-metrics", "template of the HTTP metrics source name in SumoLogic")
+	rootCmd.PersistentFlags().StringSliceVar(&FlagFailoverURLs, "failover-url", nil, "secondary receiver URLs, used in the given order when the primary receiver keeps failing")
+	rootCmd.PersistentFlags().IntVar(&FlagFailoverAfter, "failover-threshold", 3, "number of consecutive failed uploads before switching to the next receiver")
+	rootCmd.PersistentFlags().DurationVar(&FlagProbeInterval, "failover-probe-interval", 1*time.Minute, "interval to probe the primary receiver while a secondary receiver is active")
 }
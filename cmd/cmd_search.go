@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	FlagSearchFrom          string
+	FlagSearchTo            string
+	FlagSearchOutput        string
+	FlagSearchLimit         int
+	FlagSearchByReceiptTime bool
+)
+
+// searchCmd runs a query in SumoLogic, e.g. to check that the logs were delivered
+var searchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Search logs in SumoLogic",
+	Long: `Search logs in SumoLogic using the Search Job API. The time range is set with --from
+and --to, either as a duration before now (15m, 2h) or as a RFC3339 timestamp.`,
+	Example: `  jsumo search '_sourceCategory=myhost "error"' --from 1h
+  jsumo search '_sourceHost=myhost' --from 2025-01-01T00:00:00Z --to 2025-01-01T01:00:00Z --output json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		now := time.Now()
+		from, err := parseSearchTime(FlagSearchFrom, now)
+		if err != nil {
+			return err
+		}
+		to, err := parseSearchTime(FlagSearchTo, now)
+		if err != nil {
+			return err
+		}
+		if !from.Before(to) {
+			return fmt.Errorf("--from must be before --to")
+		}
+		cmd.SilenceUsage = true
+
+		encoder := json.NewEncoder(os.Stdout)
+		return RunSearch(cmd.Context(), args[0], from, to, FlagSearchByReceiptTime, FlagSearchLimit, func(message SearchMessage) error {
+			if FlagSearchOutput == "json" {
+				return encoder.Encode(message.Map)
+			}
+			_, err := fmt.Println(formatSearchMessage(message))
+			return err
+		})
+	},
+}
+
+// parseSearchTime parses the time as a duration before now or as a RFC3339 timestamp
+func parseSearchTime(value string, now time.Time) (time.Time, error) {
+	if value == "" || value == "now" {
+		return now, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(-duration), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected a duration (15m) or a RFC3339 timestamp", value)
+	}
+	return t, nil
+}
+
+// formatSearchMessage formats the message as a line with its time and raw content
+func formatSearchMessage(message SearchMessage) string {
+	raw := strings.TrimRight(message.Map["_raw"], "\n")
+	millis, err := strconv.ParseInt(message.Map["_messagetime"], 10, 64)
+	if err != nil {
+		return raw
+	}
+	return fmt.Sprintf("%s %s", time.UnixMilli(millis).UTC().Format(time.RFC3339Nano), raw)
+}
+
+func init() {
+	searchCmd.Flags().StringVar(&FlagSearchFrom, "from", "15m", "start of the time range, a duration before now or a RFC3339 timestamp")
+	searchCmd.Flags().StringVar(&FlagSearchTo, "to", "now", "end of the time range, a duration before now or a RFC3339 timestamp")
+	searchCmd.Flags().StringVarP(&FlagSearchOutput, "output", "o", "text", "output format: text or json (one JSON object per line)")
+	searchCmd.Flags().SetAnnotation("output", outputFormatsAnnotation, []string{"text", "json"})
+	searchCmd.Flags().IntVarP(&FlagSearchLimit, "limit", "l", 0, "maximum number of messages to print, 0 means no limit")
+	searchCmd.Flags().BoolVar(&FlagSearchByReceiptTime, "by-receipt-time", false, "search by the time the messages were received by SumoLogic instead of their timestamps")
+	rootCmd.AddCommand(searchCmd)
+}
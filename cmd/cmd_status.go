@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var FlagStatusOutput string
+
+// StateReport describes the working directory of jsumo: how far the cursor is behind
+// the journal and how many batch files wait for the upload
+type StateReport struct {
+	StateDir           string     `json:"state_dir"`
+	Cursor             string     `json:"cursor"`
+	CursorTime         *time.Time `json:"cursor_time"`
+	EntriesAfterCursor *int       `json:"entries_after_cursor"`
+	PendingBatches     int        `json:"pending_batches"`
+	PendingBytes       int64      `json:"pending_bytes"`
+	OldestBatch        *time.Time `json:"oldest_batch"`
+	Receiver           string     `json:"receiver,omitempty"`
+	JournalErrors      []string   `json:"journal_errors,omitempty"`
+}
+
+// runJournalctl runs the journalctl command and calls fn for every line of the output.
+// journalctl is stopped when fn returns false
+func runJournalctl(ctx context.Context, command string, fn func(line []byte) bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	errBuffer := new(bytes.Buffer)
+	cmd.Stderr = errBuffer
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	Logger.Debug("Running command", "command", cmd.String())
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	stopped := false
+	for scanner.Scan() {
+		if !fn(scanner.Bytes()) {
+			stopped = true
+			cancel()
+			break
+		}
+	}
+	err = cmd.Wait()
+	if stopped {
+		return nil
+	}
+	if err != nil {
+		return errors.Join(err, errors.New(strings.TrimSpace(errBuffer.String())))
+	}
+	return scanner.Err()
+}
+
+// cursorTime returns the time of the journal entry at the cursor. If the entry isn't in
+// the journal anymore, the time is taken from the cursor itself
+func cursorTime(ctx context.Context, cursor string) (time.Time, error) {
+	var entryTime time.Time
+	found := false
+	command := fmt.Sprintf("%s --output-fields=__CURSOR --cursor=%q", journalctlCmdPrefix, cursor)
+	err := runJournalctl(ctx, command, func(line []byte) bool {
+		entry, err := parseJournalEntry(line)
+		if err == nil && entry.Cursor() == cursor {
+			entryTime, found = entry.Time()
+		}
+		return false
+	})
+	if found {
+		return entryTime, nil
+	}
+	// The cursor contains the realtime timestamp of the entry in hex, e.g. t=5d9a7c7a1c2e0
+	for _, part := range strings.Split(cursor, ";") {
+		if value, ok := strings.CutPrefix(part, "t="); ok {
+			if usec, parseErr := strconv.ParseInt(value, 16, 64); parseErr == nil {
+				return time.UnixMicro(usec), nil
+			}
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("entry at the cursor is not found in the journal")
+	}
+	return time.Time{}, err
+}
+
+// countEntriesAfterCursor returns the number of journal entries after the cursor which
+// jsumo would read, --grep is taken into account
+func countEntriesAfterCursor(ctx context.Context, cursor string) (int, error) {
+	command := fmt.Sprintf("%s --output-fields=__CURSOR %s%q", journalctlCmdPrefix, postfixAfterCursor, cursor)
+	if FlagGrep != "" {
+		command = fmt.Sprintf("%s --grep=%q", command, FlagGrep)
+	}
+	count := 0
+	err := runJournalctl(ctx, command, func(line []byte) bool {
+		count++
+		return true
+	})
+	if err != nil && FlagGrep != "" && count == 0 {
+		// journalctl fails if grep doesn't match any entries
+		return 0, nil
+	}
+	return count, err
+}
+
+// inspectStateDir reads the cursor and the batch files from the working directory and
+// queries the journal for the entries after the cursor. Errors of journalctl are added
+// to the report
+func inspectStateDir(ctx context.Context, dir string) (StateReport, error) {
+	report := StateReport{StateDir: dir}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return report, fmt.Errorf("working directory %s doesn't exist, jsumo hasn't run yet or use --state-dir", dir)
+		}
+		return report, err
+	}
+	for _, file := range files {
+		if !isBatchFile(file.Name()) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		report.PendingBatches++
+		report.PendingBytes += info.Size()
+		if modTime := info.ModTime(); report.OldestBatch == nil || modTime.Before(*report.OldestBatch) {
+			report.OldestBatch = &modTime
+		}
+	}
+	if data, err := os.ReadFile(path.Join(dir, receiverCacheFilename)); err == nil {
+		report.Receiver = redactReceiverURL(strings.TrimSpace(string(data)))
+	}
+
+	data, err := os.ReadFile(path.Join(dir, cursorFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return report, nil
+		}
+		return report, err
+	}
+	report.Cursor = string(data)
+	if t, err := cursorTime(ctx, report.Cursor); err != nil {
+		report.JournalErrors = append(report.JournalErrors, fmt.Sprintf("unable to get the time of the cursor: %s", err))
+	} else {
+		report.CursorTime = &t
+	}
+	if count, err := countEntriesAfterCursor(ctx, report.Cursor); err != nil {
+		report.JournalErrors = append(report.JournalErrors, fmt.Sprintf("unable to count journal entries after the cursor: %s", err))
+	} else {
+		report.EntriesAfterCursor = &count
+	}
+	return report, nil
+}
+
+// formatAge formats the time as its age, e.g. 2025-01-01T10:00:00Z (5m3s ago)
+func formatAge(t *time.Time, now time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.UTC().Format(time.RFC3339), now.Sub(*t).Round(time.Second))
+}
+
+// statusCmd inspects the working directory without the running jsumo
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show how far behind the journal jsumo is",
+	Long: `Show the state of jsumo from its working directory, jsumo doesn't need to be running:
+the saved cursor and the time of its entry, the number of journal entries after the
+cursor, the number and the size of batch files waiting for the upload and the age of
+the oldest one.`,
+	Example: `  jsumo status
+  jsumo status --state-dir /var/lib/jsumo -o json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		dir, err := stateDirPath()
+		if err != nil {
+			return err
+		}
+		report, err := inspectStateDir(cmd.Context(), dir)
+		if err != nil {
+			return err
+		}
+		if FlagStatusOutput == "json" {
+			return printJSON(report)
+		}
+		now := time.Now()
+		cursor := report.Cursor
+		if cursor == "" {
+			cursor = "- (no logs were read yet)"
+		}
+		entries := "-"
+		if report.EntriesAfterCursor != nil {
+			entries = fmt.Sprint(*report.EntriesAfterCursor)
+		}
+		rows := [][]string{
+			{"State directory:", report.StateDir},
+			{"Cursor:", cursor},
+			{"Cursor time:", formatAge(report.CursorTime, now)},
+			{"Entries after cursor:", entries},
+			{"Pending batches:", fmt.Sprintf("%d (%d bytes)", report.PendingBatches, report.PendingBytes)},
+			{"Oldest batch:", formatAge(report.OldestBatch, now)},
+		}
+		if report.Receiver != "" {
+			rows = append(rows, []string{"Cached receiver:", report.Receiver})
+		}
+		if err := printTable(rows); err != nil {
+			return err
+		}
+		for _, journalErr := range report.JournalErrors {
+			fmt.Println(red(strings.ReplaceAll(journalErr, "\n", " ")))
+		}
+		return nil
+	},
+}
+
+func init() {
+	statusCmd.Flags().StringVarP(&FlagStatusOutput, "output", "o", "table", "output format: table or json")
+	rootCmd.AddCommand(statusCmd)
+}
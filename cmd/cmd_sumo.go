@@ -0,0 +1,329 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	FlagSumoOutput  string
+	FlagYes         bool
+	FlagSumoShowURL bool
+)
+
+// outputFormats are the supported values of --output
+var outputFormats = []string{"table", "json"}
+
+// outputFormatsAnnotation is the annotation of --output with the supported formats of
+// commands which don't print tables
+const outputFormatsAnnotation = "jsumo_output_formats"
+
+// checkOutputFormat returns an error if the command has --output set to an unsupported format
+func checkOutputFormat(flags *pflag.FlagSet) error {
+	f := flags.Lookup("output")
+	if f == nil {
+		return nil
+	}
+	formats := outputFormats
+	if annotated, ok := f.Annotations[outputFormatsAnnotation]; ok {
+		formats = annotated
+	}
+	if slices.Contains(formats, f.Value.String()) {
+		return nil
+	}
+	return fmt.Errorf("invalid output format %q, use %s", f.Value.String(), strings.Join(formats, " or "))
+}
+
+// sumoCmd groups commands to manage collectors and sources in SumoLogic
+var sumoCmd = &cobra.Command{
+	Use:   "sumo",
+	Short: "Manage collectors and sources in SumoLogic",
+	Long:  `Manage collectors and sources in SumoLogic. Collectors and sources can be referred to by their ID or name.`,
+}
+
+var sumoCollectorsCmd = &cobra.Command{
+	Use:   "collectors",
+	Short: "Manage collectors",
+}
+
+var sumoCollectorsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all collectors",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		collectors, err := listSumoCollectors(cmd.Context())
+		if err != nil {
+			return err
+		}
+		if FlagSumoOutput == "json" {
+			return printJSON(collectors)
+		}
+		rows := [][]string{{"ID", "NAME", "TYPE", "CATEGORY", "DESCRIPTION"}}
+		for _, c := range collectors {
+			rows = append(rows, []string{fmt.Sprint(c.ID), c.Name, c.CollectorType, c.Category, c.Description})
+		}
+		return printTable(rows)
+	},
+}
+
+var sumoCollectorsShowCmd = &cobra.Command{
+	Use:   "show <collector>",
+	Short: "Show the collector",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		collectorID, err := resolveCollectorID(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		collector, err := getSumoCollector(cmd.Context(), collectorID)
+		if err != nil {
+			return err
+		}
+		if FlagSumoOutput == "json" {
+			return printJSON(collector)
+		}
+		return printTable([][]string{
+			{"ID", fmt.Sprint(collector.ID)},
+			{"Name", collector.Name},
+			{"Type", collector.CollectorType},
+			{"Category", collector.Category},
+			{"Time zone", collector.Timezone},
+			{"Fields", formatFields(collector.Fields)},
+			{"Description", collector.Description},
+		})
+	},
+}
+
+var sumoCollectorsDeleteCmd = &cobra.Command{
+	Use:   "delete <collector>",
+	Short: "Delete the collector and all its sources",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		collectorID, err := resolveCollectorID(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		if !confirm(fmt.Sprintf("Delete collector %s (ID %d) and all its sources?", args[0], collectorID)) {
+			return fmt.Errorf("aborted")
+		}
+		err = deleteSumoCollector(cmd.Context(), collectorID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Collector %d deleted\n", collectorID)
+		return nil
+	},
+}
+
+var sumoSourcesCmd = &cobra.Command{
+	Use:   "sources",
+	Short: "Manage sources of a collector",
+}
+
+var sumoSourcesListCmd = &cobra.Command{
+	Use:   "list <collector>",
+	Short: "List all sources of the collector",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		collectorID, err := resolveCollectorID(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		sources, err := listSumoSources(cmd.Context(), collectorID)
+		if err != nil {
+			return err
+		}
+		if FlagSumoOutput == "json" {
+			return printJSON(sources)
+		}
+		rows := [][]string{{"ID", "NAME", "TYPE", "CATEGORY", "HOST"}}
+		for _, s := range sources {
+			rows = append(rows, []string{fmt.Sprint(s.ID), s.Name, s.SourceType, s.Category, s.HostName})
+		}
+		return printTable(rows)
+	},
+}
+
+var sumoSourcesShowCmd = &cobra.Command{
+	Use:   "show <collector> <source>",
+	Short: "Show the source",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		collectorID, sourceID, err := resolveSourceID(cmd.Context(), args[0], args[1])
+		if err != nil {
+			return err
+		}
+		source, err := getSumoSource(cmd.Context(), collectorID, sourceID)
+		if err != nil {
+			return err
+		}
+		if FlagSumoOutput == "json" {
+			return printJSON(source)
+		}
+		return printTable([][]string{
+			{"ID", fmt.Sprint(source.ID)},
+			{"Name", source.Name},
+			{"Type", source.SourceType},
+			{"Category", source.Category},
+			{"Host", source.HostName},
+			{"Time zone", source.Timezone},
+			{"Fields", formatFields(source.Fields)},
+			{"Multiline", fmt.Sprint(source.MultilineProcessingEnabled)},
+			{"Automatic date parsing", fmt.Sprint(source.AutomaticDateParsing)},
+			{"Description", source.Description},
+			{"URL", tableReceiverURL(source.URL)},
+		})
+	},
+}
+
+var sumoSourcesDeleteCmd = &cobra.Command{
+	Use:   "delete <collector> <source>",
+	Short: "Delete the source",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		collectorID, sourceID, err := resolveSourceID(cmd.Context(), args[0], args[1])
+		if err != nil {
+			return err
+		}
+		if !confirm(fmt.Sprintf("Delete source %s (ID %d)?", args[1], sourceID)) {
+			return fmt.Errorf("aborted")
+		}
+		err = deleteSumoSource(cmd.Context(), collectorID, sourceID)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Source %d deleted\n", sourceID)
+		return nil
+	},
+}
+
+var sumoSourcesRotateURLCmd = &cobra.Command{
+	Use:   "rotate-url <collector> <source>",
+	Short: "Generate a new receiver URL for the HTTP source",
+	Long: `Generate a new receiver URL for the HTTP source. The source is re-created with the same
+configuration, so it gets a new ID and the old receiver URL stops accepting logs. The new
+source is created with the -rotating suffix, renamed when the old source is deleted.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		collectorID, sourceID, err := resolveSourceID(cmd.Context(), args[0], args[1])
+		if err != nil {
+			return err
+		}
+		if !confirm(fmt.Sprintf("Re-create source %s (ID %d) with a new receiver URL?", args[1], sourceID)) {
+			return fmt.Errorf("aborted")
+		}
+		source, err := recreateSumoSource(cmd.Context(), collectorID, sourceID)
+		if err != nil {
+			return err
+		}
+		if FlagSumoOutput == "json" {
+			return printJSON(source)
+		}
+		return printTable([][]string{
+			{"ID", fmt.Sprint(source.ID)},
+			{"Name", source.Name},
+			{"URL", tableReceiverURL(source.URL)},
+		})
+	},
+}
+
+// resolveCollectorID returns the ID of the collector given its ID or name
+func resolveCollectorID(ctx context.Context, collector string) (int, error) {
+	if id, err := strconv.Atoi(collector); err == nil {
+		return id, nil
+	}
+	return getSumoCollectorIDFromName(ctx, collector)
+}
+
+// resolveSourceID returns the IDs of the collector and the source given their IDs or names
+func resolveSourceID(ctx context.Context, collector, source string) (int, int, error) {
+	collectorID, err := resolveCollectorID(ctx, collector)
+	if err != nil {
+		return 0, 0, err
+	}
+	if id, err := strconv.Atoi(source); err == nil {
+		return collectorID, id, nil
+	}
+	found, err := getSumoHTTPSourceFromName(ctx, collectorID, source)
+	if err != nil {
+		return 0, 0, err
+	}
+	return collectorID, found.ID, nil
+}
+
+// confirm asks the user to confirm the action, unless --yes is set
+func confirm(question string) bool {
+	if FlagYes {
+		return true
+	}
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// printJSON prints the value as indented JSON
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// printTable prints the rows aligned in columns
+func printTable(rows [][]string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// tableReceiverURL returns the receiver URL shown in table output. The URL is a secret,
+// so it is redacted unless --show-url is set
+func tableReceiverURL(receiverURL string) string {
+	if FlagSumoShowURL || receiverURL == "" {
+		return receiverURL
+	}
+	return redactReceiverURL(receiverURL)
+}
+
+// formatFields formats the fields as key=value pairs
+func formatFields(fields map[string]string) string {
+	pairs := []string{}
+	for key, value := range fields {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func init() {
+	sumoCmd.PersistentFlags().StringVarP(&FlagSumoOutput, "output", "o", "table", "output format: table or json")
+	sumoCmd.PersistentFlags().BoolVarP(&FlagYes, "yes", "y", false, "do not ask for confirmation")
+	for _, cmd := range []*cobra.Command{sumoSourcesShowCmd, sumoSourcesRotateURLCmd} {
+		cmd.Flags().BoolVar(&FlagSumoShowURL, "show-url", false, "show the full receiver URL in table output, it is redacted by default")
+	}
+
+	sumoCollectorsCmd.AddCommand(sumoCollectorsListCmd, sumoCollectorsShowCmd, sumoCollectorsDeleteCmd)
+	sumoSourcesCmd.AddCommand(sumoSourcesListCmd, sumoSourcesShowCmd, sumoSourcesDeleteCmd, sumoSourcesRotateURLCmd)
+	sumoCmd.AddCommand(sumoCollectorsCmd, sumoSourcesCmd)
+	rootCmd.AddCommand(sumoCmd)
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	FlagUnitExec           string
+	FlagUnitCredentialsDir string
+	FlagUnitCredentials    []string
+	FlagUnitWatchdog       time.Duration
+)
+
+// systemdUnitTemplate is the unit file of the jsumo service. jsumo runs as a dynamic
+// user which can read the journal, its state is kept in /var/lib/jsumo
+var systemdUnitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description=Forward journald logs to SumoLogic
+Documentation=https://github.com/jsnjack/jsumo
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart={{.ExecStart}}
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+RestartSec=5s
+# READY=1 is sent when a receiver URL is known. While it is provisioned, the start
+# timeout is extended with EXTEND_TIMEOUT_USEC= before every retry
+{{- if .Watchdog}}
+WatchdogSec={{.Watchdog}}
+{{- end}}
+TimeoutStopSec={{.TimeoutStop}}
+
+# Credentials are available in $CREDENTIALS_DIRECTORY only to the service
+{{- range .Credentials}}
+LoadCredential={{.}}
+{{- end}}
+
+# Logs are read with journalctl, state is kept in /var/lib/jsumo, sockets can be
+# created in /run/jsumo
+DynamicUser=yes
+SupplementaryGroups=systemd-journal
+StateDirectory=jsumo
+StateDirectoryMode=0700
+RuntimeDirectory=jsumo
+UMask=0077
+
+# Sandboxing
+NoNewPrivileges=yes
+CapabilityBoundingSet=
+AmbientCapabilities=
+ProtectSystem=strict
+ProtectHome=yes
+PrivateTmp=yes
+PrivateDevices=yes
+ProtectHostname=yes
+ProtectClock=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectKernelLogs=yes
+ProtectControlGroups=yes
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6
+RestrictNamespaces=yes
+RestrictRealtime=yes
+RestrictSUIDSGID=yes
+LockPersonality=yes
+MemoryDenyWriteExecute=yes
+SystemCallArchitectures=native
+SystemCallFilter=@system-service
+SystemCallFilter=~@privileged @resources
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// systemdQuote quotes the argument of ExecStart if needed. Specifiers (%) and
+// environment variables ($) are escaped, so the argument is passed as is
+// Ref: https://www.freedesktop.org/software/systemd/man/latest/systemd.service.html#Command%20lines
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\;") {
+		return arg
+	}
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	arg = strings.ReplaceAll(arg, "\n", `\n`)
+	return `"` + arg + `"`
+}
+
+// systemdDuration formats the duration as a systemd time span, e.g. 10min or 45s
+func systemdDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("%dmin", int(d/time.Minute))
+	}
+	return fmt.Sprintf("%ds", int(d/time.Second))
+}
+
+// systemdUnitCmd prints the unit file to run jsumo as a systemd service
+var systemdUnitCmd = &cobra.Command{
+	Use:   "systemd-unit [-- jsumo flags]",
+	Short: "Print a hardened systemd unit file",
+	Long: `Print a systemd unit file to run jsumo as a service. The service runs as a dynamic user
+in the systemd-journal group with sandboxing enabled, its state is kept in /var/lib/jsumo.
+Credentials are passed with LoadCredential= from files in --credentials-dir. jsumo notifies
+systemd when it is ready and pings the watchdog while logs are read and uploaded.
+
+Flags after -- are added to the command line of the service. If --config is set, it is
+added as well.`,
+	Example: `  jsumo systemd-unit > /etc/systemd/system/jsumo.service
+  jsumo systemd-unit --credential SUMO_RECEIVER_URL -- --category prod/{{unit}}
+  systemctl daemon-reload && systemctl enable --now jsumo`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		execPath := FlagUnitExec
+		if execPath == "" {
+			executable, err := os.Executable()
+			if err != nil {
+				return err
+			}
+			execPath = executable
+		}
+		command := []string{execPath}
+		if FlagConfig != "" {
+			config, err := filepath.Abs(FlagConfig)
+			if err != nil {
+				return err
+			}
+			command = append(command, "--config", config)
+		}
+		command = append(command, args...)
+		for i, arg := range command {
+			command[i] = systemdQuote(arg)
+		}
+
+		credentials := []string{}
+		for _, name := range FlagUnitCredentials {
+			// Credential files are named in lower case with dashes, see systemdProvider
+			filename := strings.ReplaceAll(strings.ToLower(name), "_", "-")
+			credentials = append(credentials, fmt.Sprintf("%s:%s", filename, path.Join(FlagUnitCredentialsDir, filename)))
+		}
+
+		data := map[string]interface{}{
+			"ExecStart":   strings.Join(command, " "),
+			"Credentials": credentials,
+			"Watchdog":    "",
+			// Leave time for the graceful shutdown before the service is killed
+			"TimeoutStop": systemdDuration(FlagShutdownTimeout + 15*time.Second),
+		}
+		if FlagUnitWatchdog > 0 {
+			data["Watchdog"] = systemdDuration(FlagUnitWatchdog)
+		}
+		return systemdUnitTemplate.Execute(os.Stdout, data)
+	},
+}
+
+func init() {
+	systemdUnitCmd.Flags().StringVar(&FlagUnitExec, "exec", "", "path to the jsumo binary, defaults to the current executable")
+	systemdUnitCmd.Flags().StringVar(&FlagUnitCredentialsDir, "credentials-dir", "/etc/jsumo", "directory with the credential files")
+	systemdUnitCmd.Flags().StringSliceVar(&FlagUnitCredentials, "credential", []string{sumoAccessIDEnvVar, sumoAccessKeyEnvVar}, "credentials loaded with LoadCredential=, e.g. SUMO_RECEIVER_URL")
+	systemdUnitCmd.Flags().DurationVar(&FlagUnitWatchdog, "watchdog", 10*time.Minute, "watchdog timeout of the service, 0 disables the watchdog")
+	rootCmd.AddCommand(systemdUnitCmd)
+}
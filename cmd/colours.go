@@ -13,30 +13,14 @@ const GrayColor = "\033[37m"
 const WhiteColor = "\033[97m"
 const CrossedColor = "\033[9m"
 
-func red(s interface{}) string {
-	return fmt.Sprintf("%s%s%s", RedColor, s, ResetColor)
-}
-
-func green(s interface{}) string {
-	return fmt.Sprintf("%s%s%s", GreenColor, s, ResetColor)
-}
-
-func yellow(s interface{}) string {
-	return fmt.Sprintf("%s%s%s", YellowColor, s, ResetColor)
-}
-
-func blue(s interface{}) string {
-	return fmt.Sprintf("%s%s%s", BlueColor, s, ResetColor)
-}
-
-func purple(s interface{}) string {
-	return fmt.Sprintf("%s%s%s", PurpleColor, s, ResetColor)
+// paint wraps the value in the colour if the output is coloured, see coloursEnabled
+func paint(colour string, s interface{}) string {
+	if !coloursEnabled {
+		return fmt.Sprint(s)
+	}
+	return fmt.Sprintf("%s%s%s", colour, s, ResetColor)
 }
 
-func cyan(s interface{}) string {
-	return fmt.Sprintf("%s%s%s", CyanColor, s, ResetColor)
-}
-
-func gray(s interface{}) string {
-	return fmt.Sprintf("%s%s%s", GrayColor, s, ResetColor)
+func red(s interface{}) string {
+	return paint(RedColor, s)
 }
@@ -0,0 +1,351 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// reloadableSettings are the keys of the configuration file which are applied again
+// on SIGHUP: filters, routing and intervals. Other settings require a restart
+var reloadableSettings = []string{"grep", "read-interval", "upload-interval", "category", "name", "host", "fields", "route", "destination"}
+
+// configEnvRe matches ${VAR} and ${VAR:-default} in the configuration file
+var configEnvRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// ReloadableSettings are the reloadable settings read outside of the reader, e.g. by the
+// uploader. They are replaced as a whole on reload, so they are never read half updated
+type ReloadableSettings struct {
+	Grep           string
+	ReadInterval   time.Duration
+	UploadInterval time.Duration
+}
+
+// reloadedSettings are the settings applied by the last reload, nil until the first one
+var reloadedSettings atomic.Pointer[ReloadableSettings]
+
+// CurrentSettings returns the reloadable settings. Until the configuration is reloaded,
+// they are the values of the flags, which aren't changed after the start
+func CurrentSettings() ReloadableSettings {
+	if settings := reloadedSettings.Load(); settings != nil {
+		return *settings
+	}
+	return ReloadableSettings{Grep: FlagGrep, ReadInterval: FlagReadInterval, UploadInterval: FlagUploadInterval}
+}
+
+// loadedConfig is the configuration file read on start, it is used to detect changes
+// of the settings which can't be reloaded
+var loadedConfig map[string]interface{}
+
+// expandConfigEnv substitutes ${VAR} and ${VAR:-default} in the value with environment
+// variables. An unset variable without a default is an error
+func expandConfigEnv(text string) (string, error) {
+	missing := []string{}
+	expanded := configEnvRe.ReplaceAllStringFunc(text, func(match string) string {
+		groups := configEnvRe.FindStringSubmatch(match)
+		if value, ok := os.LookupEnv(groups[1]); ok {
+			return value
+		}
+		if groups[2] != "" {
+			return groups[3]
+		}
+		missing = append(missing, groups[1])
+		return ""
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variables are not set: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// expandConfigNode substitutes environment variables in the scalar values of the parsed
+// configuration file, so comments are ignored and values can't change its structure
+func expandConfigNode(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		value, err := expandConfigEnv(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		node.Value = value
+		return nil
+	}
+	for i, child := range node.Content {
+		// Keys are the names of the settings, they are kept as is
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+		if err := expandConfigNode(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readConfigFile reads the YAML configuration file. Its keys are the names of the
+// global flags, e.g. read-interval: 10s. Unknown keys are rejected
+func readConfigFile(filename string, globalFlags *pflag.FlagSet) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]interface{}{}
+	document := yaml.Node{}
+	err = yaml.NewDecoder(bytes.NewReader(data)).Decode(&document)
+	if errors.Is(err, io.EOF) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", filename, err)
+	}
+	if err := expandConfigNode(&document); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", filename, err)
+	}
+	if err := document.Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", filename, err)
+	}
+	for key := range config {
+		if key == "config" || key == "version" || globalFlags.Lookup(key) == nil {
+			return nil, fmt.Errorf("invalid config file %s: unknown setting %q", filename, key)
+		}
+	}
+	return config, nil
+}
+
+// csvQuote quotes the value, so it is parsed as a single value by list and map flags
+func csvQuote(value string) string {
+	var builder strings.Builder
+	writer := csv.NewWriter(&builder)
+	writer.Write([]string{value})
+	writer.Flush()
+	return strings.TrimSuffix(builder.String(), "\n")
+}
+
+// configScalar converts a scalar value of the configuration file to a string
+func configScalar(key string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", fmt.Errorf("%s: value is empty", key)
+	case map[string]interface{}, []interface{}:
+		return "", fmt.Errorf("%s: expected a single value", key)
+	case time.Time:
+		return v.Format(time.RFC3339), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// configValues converts the value of the configuration file to the values of the
+// flag, which are set one by one
+func configValues(f *pflag.Flag, value interface{}) ([]string, error) {
+	switch f.Value.Type() {
+	case "stringSlice", "stringArray":
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		values := []string{}
+		for _, item := range items {
+			text, err := configScalar(f.Name, item)
+			if err != nil {
+				return nil, err
+			}
+			if f.Value.Type() == "stringSlice" {
+				text = csvQuote(text)
+			}
+			values = append(values, text)
+		}
+		return values, nil
+	case "stringToString":
+		items, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: expected a mapping of names to values", f.Name)
+		}
+		values := []string{}
+		for name, item := range items {
+			text, err := configScalar(f.Name+"."+name, item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, csvQuote(name+"="+text))
+		}
+		sort.Strings(values)
+		return values, nil
+	default:
+		text, err := configScalar(f.Name, value)
+		if err != nil {
+			return nil, err
+		}
+		return []string{text}, nil
+	}
+}
+
+// applyConfig sets the flags from the configuration file. Flags set on the command line
+// override the file. If keys is not empty, only these settings are applied
+func applyConfig(flags *pflag.FlagSet, config map[string]interface{}, keys []string) error {
+	names := []string{}
+	for key := range config {
+		if len(keys) == 0 || slices.Contains(keys, key) {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := flags.Lookup(name)
+		if f == nil || f.Changed {
+			continue
+		}
+		values, err := configValues(f, config[name])
+		if err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+		for _, value := range values {
+			if err := f.Value.Set(value); err != nil {
+				return fmt.Errorf("invalid config: %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// explicitSettings are the settings set on the command line or in the configuration file
+var explicitSettings = map[string]bool{}
+
+// recordExplicitSettings remembers the settings set on the command line or in the loaded
+// configuration file, as opposed to the defaults
+func recordExplicitSettings(flags *pflag.FlagSet) {
+	flags.Visit(func(f *pflag.Flag) {
+		explicitSettings[f.Name] = true
+	})
+	for key := range loadedConfig {
+		explicitSettings[key] = true
+	}
+}
+
+// settingChanged returns true if the setting was set on the command line or in the
+// configuration file
+func settingChanged(name string) bool {
+	return explicitSettings[name]
+}
+
+// LoadConfig applies the configuration file to the flags of the command. Only the
+// global flags can be set in the file
+func LoadConfig(cmd *cobra.Command, filename string) error {
+	config, err := readConfigFile(filename, cmd.Root().PersistentFlags())
+	if err != nil {
+		return err
+	}
+	if err := applyConfig(cmd.Flags(), config, nil); err != nil {
+		return err
+	}
+	loadedConfig = config
+	return nil
+}
+
+// cloneFlag adds a flag of the same type and default value to the flag set, bound to
+// a new variable
+func cloneFlag(flags *pflag.FlagSet, f *pflag.Flag) error {
+	switch f.Value.Type() {
+	case "string":
+		flags.String(f.Name, f.DefValue, f.Usage)
+	case "duration":
+		value, err := time.ParseDuration(f.DefValue)
+		if err != nil {
+			return err
+		}
+		flags.Duration(f.Name, value, f.Usage)
+	case "stringArray":
+		flags.StringArray(f.Name, nil, f.Usage)
+	case "stringToString":
+		flags.StringToString(f.Name, nil, f.Usage)
+	default:
+		return fmt.Errorf("setting %s can't be reloaded", f.Name)
+	}
+	return nil
+}
+
+// ReloadConfig reads the configuration file again and applies the filters, the routing
+// and the intervals. The new configuration is validated before it is applied, so an
+// invalid file doesn't break the running daemon. The cursor and the queued batch files
+// are kept. The flags aren't changed, the new settings are read with CurrentSettings
+func ReloadConfig(cmd *cobra.Command, filename string, j *JournalReader, journalTicker, uploadTicker *time.Ticker) error {
+	current := cmd.Root().PersistentFlags()
+	config, err := readConfigFile(filename, current)
+	if err != nil {
+		return err
+	}
+
+	// Apply the file to copies of the flags, flags set on the command line are kept
+	reloaded := pflag.NewFlagSet("reload", pflag.ContinueOnError)
+	for _, name := range reloadableSettings {
+		f := current.Lookup(name)
+		if f.Changed {
+			reloaded.AddFlag(f)
+			continue
+		}
+		if err := cloneFlag(reloaded, f); err != nil {
+			return err
+		}
+	}
+	if err := applyConfig(reloaded, config, reloadableSettings); err != nil {
+		return err
+	}
+	grep, _ := reloaded.GetString("grep")
+	readInterval, _ := reloaded.GetDuration("read-interval")
+	uploadInterval, _ := reloaded.GetDuration("upload-interval")
+	category, _ := reloaded.GetString("category")
+	name, _ := reloaded.GetString("name")
+	host, _ := reloaded.GetString("host")
+	fields, _ := reloaded.GetStringToString("fields")
+	routes, _ := reloaded.GetStringArray("route")
+	destinationURLs, _ := reloaded.GetStringToString("destination")
+	if readInterval <= 0 || uploadInterval <= 0 {
+		return fmt.Errorf("invalid config: intervals must be positive")
+	}
+	metadata, err := NewMetadataRenderer(category, name, host, fields, routes)
+	if err != nil {
+		return err
+	}
+	destinations, err := resolveDestinations(metadata.Destinations(), destinationURLs)
+	if err != nil {
+		return err
+	}
+
+	// Settings which are read only on start
+	for key, value := range config {
+		if !slices.Contains(reloadableSettings, key) && fmt.Sprint(value) != fmt.Sprint(loadedConfig[key]) {
+			Logger.Warn("Setting was changed, restart jsumo to apply it", "setting", key)
+		}
+	}
+	for key := range loadedConfig {
+		if _, ok := config[key]; !ok && !slices.Contains(reloadableSettings, key) {
+			Logger.Warn("Setting was removed, restart jsumo to apply it", "setting", key)
+		}
+	}
+
+	// Logs aren't read while the settings are replaced
+	j.Lock()
+	reloadedSettings.Store(&ReloadableSettings{Grep: grep, ReadInterval: readInterval, UploadInterval: uploadInterval})
+	j.metadata = metadata
+	setDestinations(destinations)
+	j.Unlock()
+
+	journalTicker.Reset(readInterval)
+	uploadTicker.Reset(uploadInterval)
+	Health.Expect("reader", readInterval)
+	Health.Expect("uploader", uploadInterval)
+	Logger.Info("Configuration reloaded", attrFile, filename)
+	return nil
+}
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func TestExpandConfigEnv(t *testing.T) {
+	t.Setenv("JSUMO_TEST_ENV", "prod")
+	t.Setenv("JSUMO_TEST_EMPTY", "")
+	os.Unsetenv("JSUMO_TEST_MISSING")
+	tests := []struct {
+		text    string
+		want    string
+		wantErr string
+	}{
+		{text: "no variables", want: "no variables"},
+		{text: "${JSUMO_TEST_ENV}/{{unit}}", want: "prod/{{unit}}"},
+		{text: "${JSUMO_TEST_MISSING:-staging}", want: "staging"},
+		{text: "${JSUMO_TEST_ENV:-staging}", want: "prod"},
+		{text: "${JSUMO_TEST_EMPTY:-staging}", want: ""},
+		{text: "${JSUMO_TEST_MISSING:-}", want: ""},
+		{text: "$JSUMO_TEST_ENV", want: "$JSUMO_TEST_ENV"},
+		{text: "${JSUMO_TEST_MISSING}", wantErr: "JSUMO_TEST_MISSING"},
+		{text: "${JSUMO_TEST_MISSING}-${JSUMO_TEST_MISSING2}", wantErr: "JSUMO_TEST_MISSING, JSUMO_TEST_MISSING2"},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			got, err := expandConfigEnv(test.text)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error %v, want %s", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// testConfigFlags returns global flags of the types used in the configuration file
+func testConfigFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("category", "", "")
+	flags.Duration("read-interval", 5*time.Second, "")
+	flags.StringArray("route", nil, "")
+	flags.StringSlice("failover-url", nil, "")
+	flags.StringToString("fields", nil, "")
+	return flags
+}
+
+// writeTestConfig writes the configuration file to a temporary directory
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	filename := path.Join(t.TempDir(), "jsumo.yaml")
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestReadConfigFile(t *testing.T) {
+	t.Setenv("JSUMO_TEST_ENV", "prod")
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr string
+	}{
+		{name: "empty", content: "", want: "map[]"},
+		{
+			name:    "environment variables in values",
+			content: "category: ${JSUMO_TEST_ENV}/{{unit}}\nfields:\n  env: ${JSUMO_TEST_ENV}\n",
+			want:    "map[category:prod/{{unit}} fields:map[env:prod]]",
+		},
+		{
+			name:    "comments are not expanded",
+			content: "# ${JSUMO_TEST_MISSING}\ncategory: web\n",
+			want:    "map[category:web]",
+		},
+		{
+			name:    "values can't change the structure",
+			content: "category: ${JSUMO_TEST_STRUCTURE}\n",
+			want:    "map[category:a: b\nroute: c]",
+		},
+		{name: "missing variable", content: "category: ${JSUMO_TEST_MISSING}\n", wantErr: "line 1: environment variables are not set: JSUMO_TEST_MISSING"},
+		{name: "unknown setting", content: "categroy: web\n", wantErr: `unknown setting "categroy"`},
+		{name: "config can't be set", content: "config: other.yaml\n", wantErr: `unknown setting "config"`},
+		{name: "invalid YAML", content: "category: [\n", wantErr: "invalid config file"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("JSUMO_TEST_STRUCTURE", "a: b\nroute: c")
+			config, err := readConfigFile(writeTestConfig(t, test.content), testConfigFlags())
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error %v, want %s", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(config); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		config map[string]interface{}
+		keys   []string
+		want   map[string]string
+		// wantFields is the value of --fields, its string form isn't ordered
+		wantFields map[string]string
+		wantErr    bool
+	}{
+		{
+			name:       "values of all types",
+			config:     map[string]interface{}{"category": "web", "read-interval": "10s", "route": []interface{}{"unit=a;destination=x", "priority=err"}, "failover-url": []interface{}{"https://a,b"}, "fields": map[string]interface{}{"env": "prod", "team": 1}},
+			want:       map[string]string{"category": "web", "read-interval": "10s", "route": "[unit=a;destination=x,priority=err]", "failover-url": `["https://a,b"]`},
+			wantFields: map[string]string{"env": "prod", "team": "1"},
+		},
+		{
+			name:   "command line overrides the file",
+			args:   []string{"--category", "cli"},
+			config: map[string]interface{}{"category": "file", "read-interval": "10s"},
+			want:   map[string]string{"category": "cli", "read-interval": "10s"},
+		},
+		{
+			name:   "only the given keys",
+			config: map[string]interface{}{"category": "file", "read-interval": "10s"},
+			keys:   []string{"read-interval"},
+			want:   map[string]string{"category": "", "read-interval": "10s"},
+		},
+		{name: "invalid duration", config: map[string]interface{}{"read-interval": "soon"}, wantErr: true},
+		{name: "list for a single value", config: map[string]interface{}{"category": []interface{}{"a"}}, wantErr: true},
+		{name: "empty value", config: map[string]interface{}{"category": nil}, wantErr: true},
+		{name: "list for a mapping", config: map[string]interface{}{"fields": []interface{}{"a"}}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flags := testConfigFlags()
+			if err := flags.Parse(test.args); err != nil {
+				t.Fatal(err)
+			}
+			err := applyConfig(flags, test.config, test.keys)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error: %v", err)
+			}
+			for name, want := range test.want {
+				if got := flags.Lookup(name).Value.String(); got != want {
+					t.Errorf("%s is %q, want %q", name, got, want)
+				}
+			}
+			if test.wantFields != nil {
+				if got, _ := flags.GetStringToString("fields"); !reflect.DeepEqual(got, test.wantFields) {
+					t.Errorf("fields is %v, want %v", got, test.wantFields)
+				}
+			}
+		})
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	t.Cleanup(func() { reloadedSettings.Store(nil) })
+	previousDestinations := Destinations
+	t.Cleanup(func() { setDestinations(previousDestinations) })
+	filename := writeTestConfig(t, `grep: error
+read-interval: 3s
+upload-interval: 4s
+category: reloaded/{{unit}}
+route:
+  - unit=sshd.service;destination=security
+destination:
+  security: https://security
+`)
+	reader := &JournalReader{workingDir: t.TempDir(), counter: initialCounter, since: time.Now()}
+	journalTicker, uploadTicker := time.NewTicker(time.Hour), time.NewTicker(time.Hour)
+	defer journalTicker.Stop()
+	defer uploadTicker.Stop()
+
+	// The settings are read by the uploader while they are reloaded
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				CurrentSettings()
+			}
+		}
+	}()
+	err := ReloadConfig(rootCmd, filename, reader, journalTicker, uploadTicker)
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := ReloadableSettings{Grep: "error", ReadInterval: 3 * time.Second, UploadInterval: 4 * time.Second}
+	if got := CurrentSettings(); got != want {
+		t.Errorf("settings are %+v, want %+v", got, want)
+	}
+	metadata := reader.metadata.Render(JournalEntry{"_SYSTEMD_UNIT": "sshd.service"})
+	if metadata.Category != "reloaded/sshd.service" || metadata.Destination != "security" {
+		t.Errorf("metadata is %+v", metadata)
+	}
+	if !routedDestinations() {
+		t.Error("destinations weren't set")
+	}
+
+	// An invalid file doesn't change the settings
+	invalid := writeTestConfig(t, "read-interval: 0s\n")
+	if err := ReloadConfig(rootCmd, invalid, reader, journalTicker, uploadTicker); err == nil {
+		t.Error("invalid config reloaded")
+	}
+	if got := CurrentSettings(); got != want {
+		t.Errorf("settings are %+v after the invalid reload, want %+v", got, want)
+	}
+}
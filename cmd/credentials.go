@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+)
+
+// sumoReceiverURLCredential is the name of the credential with the receiver URL. The
+// receiver URL contains a secret token, so it shouldn't be passed on the command line
+const sumoReceiverURLCredential = "SUMO_RECEIVER_URL"
+
+// systemdCredentialsDirEnvVar points to the directory with the credentials passed by
+// systemd with LoadCredential=
+// Ref: https://systemd.io/CREDENTIALS/
+const systemdCredentialsDirEnvVar = "CREDENTIALS_DIRECTORY"
+
+// ErrCredentialNotFound is returned when none of the providers has the credential
+var ErrCredentialNotFound = errors.New("credential not found")
+
+// CredentialProvider returns secrets by their name, e.g. SUMO_ACCESSID
+type CredentialProvider interface {
+	// Name returns a human readable name of the provider
+	Name() string
+	// Lookup returns the value of the credential and false if the provider
+	// doesn't have it
+	Lookup(name string) (string, bool, error)
+}
+
+// envProvider reads credentials from environment variables
+type envProvider struct{}
+
+func (p envProvider) Name() string {
+	return "environment variable"
+}
+
+func (p envProvider) Lookup(name string) (string, bool, error) {
+	value := os.Getenv(name)
+	return value, value != "", nil
+}
+
+// envFileProvider reads credentials from files set in <NAME>_FILE environment variables
+type envFileProvider struct{}
+
+func (p envFileProvider) Name() string {
+	return "_FILE environment variable"
+}
+
+func (p envFileProvider) Lookup(name string) (string, bool, error) {
+	filename := os.Getenv(name + "_FILE")
+	if filename == "" {
+		return "", false, nil
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimSpace(string(data)), true, nil
+}
+
+// systemdProvider reads credentials passed by systemd. The credential file is either
+// named as the credential (SUMO_ACCESSID) or in lower case with dashes (sumo-accessid)
+type systemdProvider struct{}
+
+func (p systemdProvider) Name() string {
+	return "systemd credential"
+}
+
+func (p systemdProvider) Lookup(name string) (string, bool, error) {
+	dir := os.Getenv(systemdCredentialsDirEnvVar)
+	if dir == "" {
+		return "", false, nil
+	}
+	for _, filename := range []string{name, strings.ReplaceAll(strings.ToLower(name), "_", "-")} {
+		data, err := os.ReadFile(path.Join(dir, filename))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", false, err
+		}
+		return strings.TrimSpace(string(data)), true, nil
+	}
+	return "", false, nil
+}
+
+// execProvider runs a helper command which prints the credentials as a JSON object,
+// e.g. {"SUMO_ACCESSID": "...", "SUMO_ACCESSKEY": "..."}. The command runs once, its
+// output or its failure is kept until the credentials are reloaded, so a broken helper
+// isn't run on every lookup
+type execProvider struct {
+	command string
+	values  map[string]string
+	err     error
+}
+
+func (p *execProvider) Name() string {
+	return "credentials helper"
+}
+
+func (p *execProvider) Lookup(name string) (string, bool, error) {
+	if p.err != nil {
+		return "", false, p.err
+	}
+	if p.values == nil {
+		p.values, p.err = p.run()
+		if p.err != nil {
+			return "", false, p.err
+		}
+	}
+	value, ok := p.values[name]
+	return value, ok && value != "", nil
+}
+
+// run runs the helper command and parses its output
+func (p *execProvider) run() (map[string]string, error) {
+	cmd := exec.Command("bash", "-c", p.command)
+	errBuffer := new(bytes.Buffer)
+	cmd.Stderr = errBuffer
+	Logger.Debug("Running credentials helper", "command", cmd.String())
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Join(err, errors.New(strings.TrimSpace(errBuffer.String())))
+	}
+	values := map[string]string{}
+	if err := json.Unmarshal(output, &values); err != nil {
+		return nil, fmt.Errorf("invalid output of credentials helper: %w", err)
+	}
+	return values, nil
+}
+
+// CredentialChain looks up credentials in the providers in the given order. Found
+// credentials are cached until Reload is called
+type CredentialChain struct {
+	sync.Mutex
+	providers []CredentialProvider
+	cache     map[string]string
+}
+
+// Get returns the value of the credential
+func (c *CredentialChain) Get(name string) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if value, ok := c.cache[name]; ok {
+		return value, nil
+	}
+	for _, provider := range c.providers {
+		value, ok, err := provider.Lookup(name)
+		if err != nil {
+			return "", fmt.Errorf("unable to read %s from %s: %w", name, provider.Name(), err)
+		}
+		if ok {
+			Logger.Debug("Credential read", "credential", name, "provider", provider.Name())
+			c.cache[name] = value
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrCredentialNotFound, name)
+}
+
+// Has returns true if the credential is available. Errors other than a missing
+// credential are returned, e.g. when the credentials helper fails
+func (c *CredentialChain) Has(name string) (bool, error) {
+	_, err := c.Get(name)
+	if errors.Is(err, ErrCredentialNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Reload drops cached credentials, so they are read from the providers again
+func (c *CredentialChain) Reload() {
+	c.Lock()
+	defer c.Unlock()
+	c.cache = map[string]string{}
+	for _, provider := range c.providers {
+		if p, ok := provider.(*execProvider); ok {
+			p.values, p.err = nil, nil
+		}
+	}
+	Logger.Info("Credentials reloaded")
+}
+
+// NewCredentialChain creates a new credential chain which looks up credentials in
+// environment variables, _FILE environment variables, systemd credentials and
+// finally in the output of the helper command, if it is set
+func NewCredentialChain(helperCommand string) *CredentialChain {
+	chain := &CredentialChain{
+		providers: []CredentialProvider{envProvider{}, envFileProvider{}, systemdProvider{}},
+		cache:     map[string]string{},
+	}
+	if helperCommand != "" {
+		chain.providers = append(chain.providers, &execProvider{command: helperCommand})
+	}
+	return chain
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// credentialsHelper returns a helper command which counts its runs in a file and prints
+// the output or fails
+func credentialsHelper(t *testing.T, output string, fail bool) (string, func() int) {
+	t.Helper()
+	runs := path.Join(t.TempDir(), "runs")
+	command := fmt.Sprintf("echo run >> %s; echo '%s'", runs, output)
+	if fail {
+		command += "; echo broken >&2; exit 1"
+	}
+	return command, func() int {
+		data, _ := os.ReadFile(runs)
+		return strings.Count(string(data), "run")
+	}
+}
+
+func TestCredentialChainProviders(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(path.Join(dir, "file"), []byte("from-file\n"), 0600)
+	os.WriteFile(path.Join(dir, "sumo-accesskey"), []byte("from-systemd\n"), 0600)
+	os.WriteFile(path.Join(dir, "SUMO_RECEIVER_URL"), []byte("from-systemd-upper"), 0600)
+	t.Setenv("SUMO_ACCESSID", "from-env")
+	t.Setenv("SUMO_ACCESSID_FILE", path.Join(dir, "file"))
+	t.Setenv("SUMO_RECEIVER_URL_SECURITY_FILE", path.Join(dir, "file"))
+	t.Setenv(systemdCredentialsDirEnvVar, dir)
+	helper, _ := credentialsHelper(t, `{"SUMO_ACCESSKEY": "from-helper", "OTHER": "from-helper"}`, false)
+	chain := NewCredentialChain(helper)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"SUMO_ACCESSID", "from-env"},
+		{"SUMO_RECEIVER_URL_SECURITY", "from-file"},
+		{"SUMO_ACCESSKEY", "from-systemd"},
+		{"SUMO_RECEIVER_URL", "from-systemd-upper"},
+		{"OTHER", "from-helper"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := chain.Get(test.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCredentialChainHas(t *testing.T) {
+	t.Setenv("SUMO_ACCESSID", "id")
+	t.Setenv("SUMO_ACCESSKEY", "")
+	t.Setenv("SUMO_RECEIVER_URL", "")
+	t.Setenv(systemdCredentialsDirEnvVar, "")
+	working, _ := credentialsHelper(t, `{"SUMO_ACCESSKEY": "key"}`, false)
+	broken, _ := credentialsHelper(t, `{}`, true)
+	invalid, _ := credentialsHelper(t, `not json`, false)
+	tests := []struct {
+		name    string
+		helper  string
+		lookup  string
+		want    bool
+		wantErr bool
+	}{
+		{name: "environment", lookup: "SUMO_ACCESSID", want: true},
+		{name: "missing", lookup: "SUMO_ACCESSKEY", want: false},
+		{name: "helper", helper: working, lookup: "SUMO_ACCESSKEY", want: true},
+		{name: "missing in helper", helper: working, lookup: "SUMO_RECEIVER_URL", want: false},
+		{name: "found before the broken helper", helper: broken, lookup: "SUMO_ACCESSID", want: true},
+		{name: "broken helper", helper: broken, lookup: "SUMO_ACCESSKEY", wantErr: true},
+		{name: "invalid output of helper", helper: invalid, lookup: "SUMO_ACCESSKEY", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewCredentialChain(test.helper).Has(test.lookup)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error: %v", err)
+			}
+			if errors.Is(err, ErrCredentialNotFound) {
+				t.Errorf("missing credential returned as an error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCredentialChainCachesHelper(t *testing.T) {
+	t.Setenv("SUMO_ACCESSID", "")
+	t.Setenv("SUMO_ACCESSKEY", "")
+	t.Setenv(systemdCredentialsDirEnvVar, "")
+	for _, fail := range []bool{false, true} {
+		t.Run(fmt.Sprintf("fail %t", fail), func(t *testing.T) {
+			helper, runs := credentialsHelper(t, `{"SUMO_ACCESSID": "id"}`, fail)
+			chain := NewCredentialChain(helper)
+			for _, name := range []string{"SUMO_ACCESSID", "SUMO_ACCESSKEY", "SUMO_ACCESSID"} {
+				_, err := chain.Get(name)
+				if fail && (err == nil || !strings.Contains(err.Error(), "broken")) {
+					t.Errorf("error of the broken helper: %v", err)
+				}
+			}
+			if runs() != 1 {
+				t.Errorf("helper ran %d times, want once", runs())
+			}
+			chain.Reload()
+			chain.Get("SUMO_ACCESSID")
+			if runs() != 2 {
+				t.Errorf("helper ran %d times after reload, want twice", runs())
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// dryRunStdout is the value of --dry-run which writes the logs to stdout
+const dryRunStdout = "-"
+
+// DryRunWriter writes batch files to stdout or to a directory instead of uploading them,
+// so the filters, the formatting and the routing can be checked without SumoLogic
+type DryRunWriter struct {
+	dir     string // Batch files are copied to this directory, empty for stdout
+	counter int    // Counter of the last batch file in the directory
+}
+
+// Write writes the batch file out and removes it from the working directory. The logs
+// are printed to stdout as they would be sent, the metadata is logged
+func (w *DryRunWriter) Write(filename string) error {
+	entries, summary, err := readBatchFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			removeBatchMetadata(filename)
+			return nil
+		}
+		return err
+	}
+	metadata := summary.Metadata
+	attrs := []any{
+		attrFile, filename,
+		attrEntries, summary.Entries,
+		attrBytes, summary.CompressedSize,
+		attrDestination, metadata.DestinationName(),
+		attrCategory, metadata.Category,
+		"name", metadata.Name,
+		"host", metadata.Host,
+	}
+
+	if w.dir == "" {
+		Logger.Info("Dry run, batch file written to stdout", attrs...)
+		for _, entry := range entries {
+			fmt.Println(entry)
+		}
+	} else {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		w.counter++
+		target := path.Join(w.dir, fmt.Sprintf("%s%d%s", batchFilenamePrefix, w.counter, batchFilenameSuffix))
+		if err := writeBatchMetadata(target, summary.Metadata); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return err
+		}
+		Logger.Info("Dry run, batch file written", append(attrs, "target", target)...)
+	}
+
+	if err := os.Remove(filename); err != nil {
+		Logger.Error("Unable to remove the batch file", attrFile, filename, errAttr(err))
+	}
+	removeBatchMetadata(filename)
+	return nil
+}
+
+// NewDryRunWriter creates the writer for --dry-run: "-" writes the logs to stdout, other
+// values are directories for the batch files. Batch files already in the directory are
+// kept, the new ones are numbered after them
+func NewDryRunWriter(output string) (*DryRunWriter, error) {
+	if output == dryRunStdout {
+		return &DryRunWriter{}, nil
+	}
+	if err := os.MkdirAll(output, 0755); err != nil {
+		return nil, err
+	}
+	files, err := batchFilesIn(output)
+	if err != nil {
+		return nil, err
+	}
+	return &DryRunWriter{dir: output, counter: max(initialCounter, highestBatchCounter(files))}, nil
+}
+
+// NewDryRunJournalReader creates a journal reader with a temporary working directory. The
+// cursor of jsumo is copied to it, so new logs are read from the cursor but the cursor
+// itself isn't moved. The caller removes the directory
+func NewDryRunJournalReader() (*JournalReader, error) {
+	dir, err := os.MkdirTemp("", "jsumo-dry-run-")
+	if err != nil {
+		return nil, err
+	}
+	stateDir, err := stateDirPath()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	cursor, err := os.ReadFile(path.Join(stateDir, cursorFilename))
+	switch {
+	case err == nil:
+		err = os.WriteFile(path.Join(dir, cursorFilename), cursor, 0644)
+	case os.IsNotExist(err):
+		err = nil
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	reader, err := newJournalReader(dir, time.Now())
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return reader, nil
+}
+
+// runDryRun reads the logs every read interval and writes the batch files out, or only
+// once with --once. The logs are written to stdout, so jsumo logs to stderr
+func runDryRun(ctx context.Context) error {
+	writer, err := NewDryRunWriter(FlagDryRun)
+	if err != nil {
+		return err
+	}
+	if writer.dir == "" {
+		if err := setupLogger(os.Stderr); err != nil {
+			return err
+		}
+	}
+	journalReader, err := NewDryRunJournalReader()
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(journalReader.workingDir)
+	DryRun = writer
+	UploadQueue = Queue{}
+
+	if FlagOnce {
+		return runOnce(ctx, journalReader)
+	}
+	Logger.Info("Dry run, the cursor isn't moved", attrInterval, FlagReadInterval)
+	ticker := time.NewTicker(FlagReadInterval)
+	defer ticker.Stop()
+	for {
+		err := runOnce(ctx, journalReader)
+		if err != nil && ctx.Err() == nil {
+			Logger.Error("Dry run failed", errAttr(err))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// heartbeat is the liveness of a loop, e.g. the reader of the logs
+type heartbeat struct {
+	last     time.Time
+	interval time.Duration // Interval of the loop
+}
+
+// HealthTracker tracks the liveness of the reader and the uploader, the last error and
+// the last successful upload. It backs the health endpoints and the systemd watchdog.
+// All methods are safe to call on a nil tracker
+type HealthTracker struct {
+	sync.Mutex
+	startedAt   time.Time
+	heartbeats  map[string]*heartbeat
+	lastError   string
+	lastErrorAt time.Time
+	lastUpload  time.Time
+}
+
+// Expect registers a loop which must report its liveness with Heartbeat every interval.
+// It is called again when the interval changes
+func (h *HealthTracker) Expect(name string, interval time.Duration) {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	if hb, ok := h.heartbeats[name]; ok {
+		hb.interval = interval
+		return
+	}
+	h.heartbeats[name] = &heartbeat{last: time.Now(), interval: interval}
+}
+
+// Heartbeat reports that the loop is alive
+func (h *HealthTracker) Heartbeat(name string) {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	if hb, ok := h.heartbeats[name]; ok {
+		hb.last = time.Now()
+	}
+}
+
+// Stalled returns the loops which didn't report their liveness within their interval
+// and the tolerance
+func (h *HealthTracker) Stalled(tolerance time.Duration) []string {
+	if h == nil {
+		return nil
+	}
+	h.Lock()
+	defer h.Unlock()
+	names := []string{}
+	for name, hb := range h.heartbeats {
+		if since := time.Since(hb.last); since > hb.interval+tolerance {
+			names = append(names, fmt.Sprintf("%s (%s)", name, since.Round(time.Second)))
+		}
+	}
+	return names
+}
+
+// ReportError stores the error as the last error
+func (h *HealthTracker) ReportError(err error) {
+	if h == nil || err == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	h.lastError = err.Error()
+	h.lastErrorAt = time.Now()
+}
+
+// ReportUpload stores the time of the successful upload
+func (h *HealthTracker) ReportUpload() {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	h.lastUpload = time.Now()
+}
+
+// LastError returns the last error and its time. The error is empty if there were no errors
+func (h *HealthTracker) LastError() (string, time.Time) {
+	if h == nil {
+		return "", time.Time{}
+	}
+	h.Lock()
+	defer h.Unlock()
+	return h.lastError, h.lastErrorAt
+}
+
+// StartedAt returns the time jsumo was started
+func (h *HealthTracker) StartedAt() time.Time {
+	if h == nil {
+		return time.Time{}
+	}
+	return h.startedAt
+}
+
+// LastUpload returns the time of the last successful upload, zero if nothing was uploaded yet
+func (h *HealthTracker) LastUpload() time.Time {
+	if h == nil {
+		return time.Time{}
+	}
+	h.Lock()
+	defer h.Unlock()
+	return h.lastUpload
+}
+
+// UploadsRecent returns true if the upload queue is empty or a batch file was uploaded
+// within maxAge. The start of jsumo is treated as an upload, so a restart doesn't make
+// it unready immediately
+func (h *HealthTracker) UploadsRecent(maxAge time.Duration) bool {
+	if h == nil || UploadQueue.Len() == 0 {
+		return true
+	}
+	h.Lock()
+	defer h.Unlock()
+	last := h.lastUpload
+	if last.Before(h.startedAt) {
+		last = h.startedAt
+	}
+	return time.Since(last) <= maxAge
+}
+
+// NewHealthTracker creates a new health tracker
+func NewHealthTracker() *HealthTracker {
+	return &HealthTracker{
+		startedAt:  time.Now(),
+		heartbeats: map[string]*heartbeat{},
+	}
+}
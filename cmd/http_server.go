@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// unixSocketPrefix is the prefix of the listen address of a unix socket, e.g. unix:/run/jsumo/http.sock
+const unixSocketPrefix = "unix:"
+
+// livenessTolerance is the time the reader and the uploader may stay stuck before
+// /healthz fails. It covers the timeout of a single upload
+const livenessTolerance = 10 * time.Minute
+
+// StatusError is the last error in the status document
+type StatusError struct {
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// StatusBatch is a batch file waiting for the upload
+type StatusBatch struct {
+	File        string    `json:"file"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	Destination string    `json:"destination,omitempty"`
+}
+
+// Status is the state of the running jsumo, served on /status
+type Status struct {
+	Version    string        `json:"version"`
+	StartedAt  time.Time     `json:"started_at"`
+	Ready      bool          `json:"ready"`
+	Paused     bool          `json:"paused"`
+	Receiver   string        `json:"receiver"`
+	Cursor     string        `json:"cursor"`
+	Queue      []StatusBatch `json:"queue"`
+	SpoolBytes int64         `json:"spool_bytes"`
+	LastError  *StatusError  `json:"last_error"`
+	LastUpload *time.Time    `json:"last_upload"`
+	Stalled    []string      `json:"stalled,omitempty"`
+}
+
+// spoolSize returns the size of the batch files and their metadata in the directory
+func spoolSize(dir string) (int64, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), batchFilenamePrefix) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue // Uploaded in the meantime
+		}
+		size += info.Size()
+	}
+	return size, nil
+}
+
+// queuedBatches returns the batch files in the upload queue
+func queuedBatches() []StatusBatch {
+	batches := []StatusBatch{}
+	for _, file := range UploadQueue.Files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue // Uploaded in the meantime
+		}
+		metadata, _ := readBatchMetadata(file)
+		batches = append(batches, StatusBatch{
+			File:        file,
+			Size:        info.Size(),
+			CreatedAt:   info.ModTime(),
+			Destination: metadata.Destination,
+		})
+	}
+	return batches
+}
+
+// isReady returns true if the receiver URL and the metrics source are provisioned and
+// the batch files are uploaded. The reason is returned if it isn't ready
+func isReady() (bool, string) {
+	if Receivers == nil || Receivers.Current() == "" {
+		return false, "receiver URL is not resolved"
+	}
+	if err := Metrics.ProvisionError(); err != nil {
+		return false, fmt.Sprintf("metrics source is not provisioned: %s", err)
+	}
+	if !Health.UploadsRecent(FlagReadyUploadAge) {
+		return false, fmt.Sprintf("no successful uploads in the last %s", FlagReadyUploadAge)
+	}
+	return true, ""
+}
+
+// currentStatus collects the status of jsumo. The state directory is read to get the
+// cursor and the size of the spool
+func currentStatus(stateDir string) Status {
+	status := Status{
+		Version:   Version,
+		StartedAt: Health.StartedAt(),
+		Paused:    Admin.Paused(),
+		Stalled:   Health.Stalled(livenessTolerance),
+	}
+	status.Ready, _ = isReady()
+	if Receivers != nil {
+		status.Receiver = redactReceiverURL(Receivers.Current())
+	}
+	if cursor, err := os.ReadFile(path.Join(stateDir, cursorFilename)); err == nil {
+		status.Cursor = string(cursor)
+	}
+	status.Queue = queuedBatches()
+	status.SpoolBytes, _ = spoolSize(stateDir)
+	if message, at := Health.LastError(); message != "" {
+		status.LastError = &StatusError{Message: message, Time: at}
+	}
+	if lastUpload := Health.LastUpload(); !lastUpload.IsZero() {
+		status.LastUpload = &lastUpload
+	}
+	return status
+}
+
+// newHTTPHandler returns the handler with the metrics, health and status endpoints:
+//   - /metrics - Prometheus metrics
+//   - /healthz - the reader and the uploader are alive
+//   - /readyz - the receiver URL and the metrics source are provisioned and the batch files are uploaded
+//   - /status - JSON document with the state of jsumo
+func newHTTPHandler(stateDir string) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if stalled := Health.Stalled(livenessTolerance); len(stalled) > 0 {
+			http.Error(w, fmt.Sprintf("stalled: %s", strings.Join(stalled, ", ")), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if ready, reason := isReady(); !ready {
+			http.Error(w, reason, http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(currentStatus(stateDir))
+	})
+	return mux
+}
+
+// listen listens on the TCP address (127.0.0.1:2112) or on the unix socket (unix:/run/jsumo/http.sock).
+// A stale socket left after a crash is removed
+func listen(address string) (net.Listener, error) {
+	socket, ok := strings.CutPrefix(address, unixSocketPrefix)
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+	if info, err := os.Stat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(socket); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", socket)
+}
+
+// StartHTTPServer serves the metrics, health and status endpoints on the address in
+// the background. The returned server is closed on shutdown
+func StartHTTPServer(address, stateDir string) (*http.Server, error) {
+	listener, err := listen(address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on %s: %w", address, err)
+	}
+	server := &http.Server{
+		Handler:           newHTTPHandler(stateDir),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			Logger.Error("HTTP server stopped", errAttr(err))
+		}
+	}()
+	Logger.Info("Serving metrics, health and status", "address", address)
+	return server, nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestListenDefault(t *testing.T) {
+	// The endpoints expose the status of the host, so they aren't reachable from the
+	// network unless asked for
+	if got := rootCmd.PersistentFlags().Lookup("listen").DefValue; got != "127.0.0.1:2112" {
+		t.Errorf("--listen defaults to %q", got)
+	}
+}
+
+func TestListen(t *testing.T) {
+	dir := t.TempDir()
+	stale := path.Join(dir, "stale.sock")
+	listener, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The socket file is left behind as after a crash
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	tests := []struct {
+		name    string
+		address string
+		network string
+		wantErr bool
+	}{
+		{name: "tcp", address: "127.0.0.1:0", network: "tcp"},
+		{name: "unix socket", address: unixSocketPrefix + path.Join(dir, "http.sock"), network: "unix"},
+		{name: "stale unix socket", address: unixSocketPrefix + stale, network: "unix"},
+		{name: "missing directory", address: unixSocketPrefix + path.Join(dir, "missing", "http.sock"), wantErr: true},
+		{name: "invalid address", address: "localhost", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			listener, err := listen(test.address)
+			if test.wantErr {
+				if err == nil {
+					listener.Close()
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+			if got := listener.Addr().Network(); got != test.network {
+				t.Errorf("listening on %s, want %s", got, test.network)
+			}
+		})
+	}
+
+	// Other files aren't removed
+	file := path.Join(dir, "file")
+	os.WriteFile(file, nil, 0600)
+	if _, err := listen(unixSocketPrefix + file); err == nil {
+		t.Error("listening on a regular file")
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("regular file removed: %v", err)
+	}
+}
+
+func TestIsReady(t *testing.T) {
+	tests := []struct {
+		name         string
+		receiver     string
+		provisionErr error
+		wantReady    bool
+		wantReason   string
+	}{
+		{name: "ready", receiver: "https://collectors/receiver/v1/http/token", wantReady: true},
+		{name: "receiver not resolved", wantReason: "receiver URL is not resolved"},
+		{
+			name:         "metrics source not provisioned",
+			receiver:     "https://collectors/receiver/v1/http/token",
+			provisionErr: errors.New("internal error"),
+			wantReason:   "metrics source is not provisioned: internal error",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previousReceivers, previousMetrics := Receivers, Metrics
+			t.Cleanup(func() { Receivers, Metrics = previousReceivers, previousMetrics })
+			Receivers = NewReceiverPool(nil, 1)
+			if test.receiver != "" {
+				Receivers.SetPrimary(test.receiver)
+			}
+			Metrics = &MetricsForwarder{autoProvisioned: true, provisionErr: test.provisionErr}
+
+			ready, reason := isReady()
+			if ready != test.wantReady || reason != test.wantReason {
+				t.Errorf("isReady() = %v, %q, want %v, %q", ready, reason, test.wantReady, test.wantReason)
+			}
+		})
+	}
+}
@@ -2,23 +2,24 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
 	"path"
 	"strings"
+	"sync"
 	"time"
-
-	"github.com/klauspost/compress/zstd"
 )
 
 // workingDir is the directory where the application stores files
 const workingDir = ".local/jsumo/"
 
-// journalctlCmdPrefix is the prefix of the journalctl command. It is meant to produce
-// logs and the cursor (last log line)
-const journalctlCmdPrefix = "journalctl --output=short-iso-precise --utc --show-cursor --quiet"
+// journalctlCmdPrefix is the prefix of the journalctl command. It produces one JSON object
+// per log entry with all journal fields, including the cursor of the entry
+const journalctlCmdPrefix = "journalctl --output=json --quiet"
 
 // postfixAfterCursor is the postfix of the journalctl command to get logs after the cursor
 const postfixAfterCursor = "--after-cursor="
@@ -26,6 +27,15 @@ const postfixAfterCursor = "--after-cursor="
 // postfixSinceStart is the postfix of the journalctl command to get logs since the start of the program
 const postfixSinceStart = "--since="
 
+// postfixUntil is the postfix of the journalctl command to get logs until the given time
+const postfixUntil = "--until="
+
+// journalctlTimeFormat is the format of the time in --since and --until, in the local time zone
+const journalctlTimeFormat = "2006-01-02 15:04:05"
+
+// stateDirectoryEnvVar is set by systemd to the directory configured with StateDirectory=
+const stateDirectoryEnvVar = "STATE_DIRECTORY"
+
 // cursorFile is the file where the cursor is stored
 const cursorFilename = "jsumo-cursor"
 
@@ -40,10 +50,26 @@ const initialCounter = 1000000
 // batchFilenamePrefix is the prefix of the batch files
 const batchFilenamePrefix = "batch-"
 
+// batchFilenameSuffix is the suffix of the batch files
+const batchFilenameSuffix = ".zst.jsumo"
+
+// JournalReader reads logs from journalctl. It is locked while the logs are read, so
+// the filters and the routing can be replaced safely when the configuration is reloaded
 type JournalReader struct {
-	startedAt  time.Time
-	workingDir string // Working directory
-	counter    int    // Used for batching
+	sync.Mutex
+	since      time.Time // Logs are read since this time if there is no cursor yet
+	until      time.Time // Logs are read until this time, if set
+	workingDir string    // Working directory
+	counter    int       // Used for batching
+	metadata   *MetadataRenderer
+}
+
+// pendingBatch collects the formatted log lines with the same metadata
+type pendingBatch struct {
+	metadata  BatchMetadata
+	buffer    bytes.Buffer
+	entries   int      // Number of entries in the batch
+	canaryIDs []string // Canary messages in the batch
 }
 
 // getJournalctlCmd returns the journalctl command to get logs
@@ -59,12 +85,15 @@ func (j *JournalReader) getJournalctlCmd() (string, error) {
 
 	// If the cursor file doesn't exist, start logs from the time the program started
 	if os.IsNotExist(err) {
-		cmdStr = fmt.Sprintf("%s %s%q", journalctlCmdPrefix, postfixSinceStart, j.startedAt.Format("2006-01-02 15:04:05"))
+		cmdStr = fmt.Sprintf("%s %s%q", journalctlCmdPrefix, postfixSinceStart, j.since.Local().Format(journalctlTimeFormat))
+	}
+	if !j.until.IsZero() {
+		cmdStr = fmt.Sprintf("%s %s%q", cmdStr, postfixUntil, j.until.Local().Format(journalctlTimeFormat))
 	}
 
-	// Add grep argument to the command if FlagGrep is set
-	if FlagGrep != "" {
-		cmdStr = fmt.Sprintf("%s --grep=%q", cmdStr, FlagGrep)
+	// Add grep argument to the command if it is set
+	if grep := CurrentSettings().Grep; grep != "" {
+		cmdStr = fmt.Sprintf("%s --grep=%q", cmdStr, grep)
 	}
 	return cmdStr, nil
 }
@@ -83,10 +112,13 @@ func (j *JournalReader) writeCursorFile(filename, cursor string) error {
 	return os.WriteFile(filename, []byte(cursor), 0644)
 }
 
-// ReadLogs reads logs from journalctl and prepares them for sending to SumoLogic
-func (j *JournalReader) ReadLogs() error {
+// ReadLogs reads logs from journalctl and prepares them for sending to SumoLogic. If the
+// context is cancelled, journalctl is stopped and the cursor isn't moved
+func (j *JournalReader) ReadLogs(ctx context.Context) error {
+	j.Lock()
+	defer j.Unlock()
 	startedAt := time.Now()
-	DebugLogger.Println(green("Reading logs from journalctl..."))
+	Logger.Debug("Reading logs from journalctl...")
 
 	if !j.shouldReadNewLogs() {
 		return nil
@@ -96,133 +128,160 @@ func (j *JournalReader) ReadLogs() error {
 	if err != nil {
 		return err
 	}
-	cmd := exec.Command("bash", "-c", journalCmd)
+	cmd := exec.CommandContext(ctx, "bash", "-c", journalCmd)
 	errBuffer := new(bytes.Buffer)
 	cmd.Stderr = errBuffer
-	DebugLogger.Printf("Running command: %s\n", cmd.String())
+	Logger.Debug("Running command", "command", cmd.String())
 	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if err != nil {
-		if FlagGrep != "" && errBuffer.Len() == 0 {
-			DebugLogger.Println(yellow("Errored with no output, skipping beacuse grep didn't match any logs"))
+		if CurrentSettings().Grep != "" && errBuffer.Len() == 0 {
+			Logger.Debug("Errored with no output, skipping beacuse grep didn't match any logs")
 		} else {
 			return errors.Join(err, errors.New(strings.TrimSpace(errBuffer.String())))
 		}
 	}
-	DebugLogger.Printf("Logs read from journalctl, took %s, size %d\n", time.Since(startedAt), len(output))
-	j.processLogs(&output)
-	return nil
+	Logger.Debug("Logs read from journalctl", attrBytes, len(output), attrDuration, time.Since(startedAt))
+	return j.processLogs(&output)
 }
 
 // createBatchFile creates a batch file with the logs, ready to be sent to sumologic HTTP source.
 // The file represent a POST request body to the endpoint, compressed with zstd.
 // Ref: https://help.sumologic.com/docs/send-data/hosted-collectors/http-source/logs-metrics/upload-logs/
-func (j *JournalReader) createBatchFile(data *[]byte) error {
+// The metadata of the batch is stored in a separate file next to it.
+func (j *JournalReader) createBatchFile(data *[]byte, metadata BatchMetadata, entries int) (string, error) {
 	startedAt := time.Now()
 
 	j.counter++
-	filename := path.Join(j.workingDir, fmt.Sprintf("%s%d.zst.jsumo", batchFilenamePrefix, j.counter))
-
-	DebugLogger.Println(green(fmt.Sprintf("Creating batch file %s...", filename)))
-	defer func() {
-		DebugLogger.Printf("Batch file created %s, took %s\n", filename, time.Since(startedAt))
-	}()
+	filename := path.Join(j.workingDir, fmt.Sprintf("%s%d%s", batchFilenamePrefix, j.counter, batchFilenameSuffix))
 
-	// Create a buffer to hold the compressed data
-	var compressedData bytes.Buffer
-
-	// Create a zstd encoder
-	encoder, err := zstd.NewWriter(&compressedData)
-	if err != nil {
-		return err
-	}
-	defer encoder.Close()
+	Logger.Debug("Creating batch file...", attrFile, filename)
 
-	// Write the data to the encoder
-	_, err = encoder.Write(*data)
+	compressedData, err := compressBatch(*data)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	// Flush the encoder to ensure all data is written
-	err = encoder.Close()
+	// The metadata is written first, so the batch file is never uploaded without it
+	err = writeBatchMetadata(filename, metadata)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	DebugLogger.Printf("Compression rate: %.2fx\n", float64(len(*data))/float64(len(compressedData.Bytes())))
-
 	// Write the compressed data to the file
-	err = os.WriteFile(filename, compressedData.Bytes(), 0644)
+	err = os.WriteFile(filename, compressedData, 0644)
 	if err != nil {
-		return err
+		return "", err
 	}
 
+	Logger.Info("Batch file created",
+		attrFile, filename,
+		attrEntries, entries,
+		attrBytes, len(compressedData),
+		"ratio", math.Round(float64(len(*data))/float64(len(compressedData))*100)/100,
+		attrDestination, metadata.DestinationName(),
+		attrCategory, metadata.Category,
+		attrDuration, time.Since(startedAt),
+	)
+
 	// Add the file to the queue
 	UploadQueue.AddFile(filename)
-	return nil
+	return filename, nil
 }
 
 // shouldReadNewLogs returns true if the logs should be read again. Normally it means
-// that all batch files have been sent to SumoLogic
+// that all batch files have been sent to SumoLogic. When routes are configured, logs are
+// also read while only the batch files of failing destinations are waiting, so the other
+// destinations keep receiving logs. New batch files are numbered after the waiting ones
 func (j *JournalReader) shouldReadNewLogs() bool {
-	files, err := os.ReadDir(j.workingDir)
+	files, err := batchFilesIn(j.workingDir)
 	if err != nil {
-		Logger.Println(red(fmt.Sprintf("Error reading directory %s: %s\n", j.workingDir, err)))
+		Logger.Error("Unable to read the working directory", "dir", j.workingDir, errAttr(err))
+		return false
+	}
+	j.counter = max(initialCounter, highestBatchCounter(files))
+	if len(files) == 0 {
+		return true
+	}
+	// New files are added to the queue just after they are created,
+	// this is mostly to recover from a shutdown
+	if UploadQueue.Len() == 0 {
+		for _, file := range files {
+			UploadQueue.AddFile(file)
+		}
+	}
+	if !routedDestinations() || len(files) >= maxDeferredBatches {
 		return false
 	}
-	found := false
 	for _, file := range files {
-		if strings.HasPrefix(file.Name(), batchFilenamePrefix) {
-			found = true
-			// New files are added to the queue just after they are created,
-			// this is mostly to recover from a shutdown
-			if UploadQueue.Len() == 0 {
-				UploadQueue.AddFile(path.Join(j.workingDir, file.Name()))
-			}
+		if !FailingDestinations.IsFailing(batchDestination(file)) {
+			return false
 		}
 	}
-	return !found
-
+	Logger.Debug("Reading logs while batch files of failing destinations are waiting", attrQueue, len(files))
+	return true
 }
 
+// processLogs splits the journal entries into batches by their metadata and creates
+// the batch files. The cursor is moved to the last entry when all batches are created
 func (j *JournalReader) processLogs(logs *[]byte) error {
 	startedAt := time.Now()
-	DebugLogger.Println(green("Processing logs..."))
+	Logger.Debug("Processing logs...")
 	defer func() {
-		j.counter = initialCounter
-		DebugLogger.Printf("Logs processed, took %s\n", time.Since(startedAt))
+		Logger.Debug("Logs processed", attrDuration, time.Since(startedAt))
 	}()
 	if len(*logs) == 0 {
 		return nil
 	}
-	logsStr := string(*logs)
-	logsSlice := strings.Split(logsStr, "\n")
-	Logger.Printf("Read %d lines\n", len(logsSlice))
-	if len(logsSlice) < 2 {
-		return fmt.Errorf("at least 2 lines expected, got %d", len(logsSlice))
-	}
-	metricLinesRead.Add(float64(len(logsSlice) - 2))
-	// Last line is the new line, and the second last line is the cursor
-	cursorValue := strings.TrimPrefix(logsSlice[len(logsSlice)-2], "-- cursor: ")
-	buffer := bytes.Buffer{}
-	for _, line := range logsSlice[:len(logsSlice)-2] {
-		buffer.WriteString(line + "\n")
-		if buffer.Len() > batchSize {
-			newBatch := buffer.Bytes()
-			err := j.createBatchFile(&newBatch)
+	lines := bytes.Split(bytes.TrimSpace(*logs), []byte("\n"))
+	Logger.Info("Logs read", "lines", len(lines))
+	metricLinesRead.Add(float64(len(lines)))
+
+	cursorValue := ""
+	batches := map[string]*pendingBatch{}
+	order := []string{} // Batches are created in the order of their first entry
+	for _, line := range lines {
+		entry, err := parseJournalEntry(line)
+		formatted := ""
+		if err != nil {
+			// The line is sent as it is, so no logs are lost when the cursor is moved
+			Logger.Warn("Unable to parse journal entry, sending it as is", errAttr(err))
+			entry = JournalEntry{}
+			formatted = string(line)
+		} else {
+			cursorValue = entry.Cursor()
+			formatted = entry.Format()
+		}
+
+		metadata := j.metadata.Render(entry)
+		key := metadata.key()
+		batch, ok := batches[key]
+		if !ok {
+			batch = &pendingBatch{metadata: metadata}
+			batches[key] = batch
+			order = append(order, key)
+		}
+		batch.buffer.WriteString(formatted + "\n")
+		batch.entries++
+		batch.canaryIDs = append(batch.canaryIDs, Canary.Find(formatted)...)
+		if batch.buffer.Len() > batchSize {
+			err := j.flushBatch(batch)
 			if err != nil {
 				return err
 			}
-			buffer.Reset()
 		}
 	}
-	if buffer.Len() > 0 {
-		newBatch := buffer.Bytes()
-		err := j.createBatchFile(&newBatch)
+	for _, key := range order {
+		err := j.flushBatch(batches[key])
 		if err != nil {
 			return err
 		}
 	}
+	if cursorValue == "" {
+		return fmt.Errorf("cursor is missing in the output of journalctl")
+	}
 
 	// Write the cursor to the cursor file
 	cursorFile := path.Join(j.workingDir, cursorFilename)
@@ -233,21 +292,74 @@ func (j *JournalReader) processLogs(logs *[]byte) error {
 	return nil
 }
 
+// flushBatch creates a batch file from the pending batch and resets it
+func (j *JournalReader) flushBatch(batch *pendingBatch) error {
+	if batch.buffer.Len() == 0 {
+		return nil
+	}
+	data := batch.buffer.Bytes()
+	filename, err := j.createBatchFile(&data, batch.metadata, batch.entries)
+	if err != nil {
+		return err
+	}
+	Canary.Batched(batch.canaryIDs, filename)
+	batch.canaryIDs = nil
+	batch.entries = 0
+	batch.buffer.Reset()
+	return nil
+}
+
+// stateDirPath returns the working directory of the application: --state-dir, the
+// directory set by systemd with StateDirectory= or ~/.local/jsumo
+func stateDirPath() (string, error) {
+	if FlagStateDir != "" {
+		return FlagStateDir, nil
+	}
+	if dir := os.Getenv(stateDirectoryEnvVar); dir != "" {
+		// systemd sets a colon separated list if there are multiple directories
+		dir, _, _ = strings.Cut(dir, ":")
+		return dir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(homeDir, workingDir), nil
+}
+
+// getStateDir returns the working directory of the application, creating it if needed
+func getStateDir() (string, error) {
+	dir, err := stateDirPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
 // NewJournalReader creates a new Journal instance
 func NewJournalReader() (*JournalReader, error) {
 	// Create working directory
-	homeDir, err := os.UserHomeDir()
+	dir, err := getStateDir()
 	if err != nil {
 		return nil, err
 	}
+	return newJournalReader(dir, time.Now())
+}
 
-	dir := path.Join(homeDir, workingDir)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+// newJournalReader creates a journal reader which stores the cursor and the batch files
+// in the directory. Logs are read since the given time if there is no cursor yet
+func newJournalReader(dir string, since time.Time) (*JournalReader, error) {
+	metadata, err := NewMetadataRenderer(FlagSourceCategory, FlagSumoName, FlagSumoHost, FlagSumoFields, FlagRoutes)
+	if err != nil {
 		return nil, err
 	}
 	return &JournalReader{
-		startedAt:  time.Now(),
+		since:      since,
 		workingDir: dir,
 		counter:    initialCounter,
+		metadata:   metadata,
 	}, nil
 }
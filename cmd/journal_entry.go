@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// journalTimeFormat is the time format of short-iso-precise output of journalctl
+const journalTimeFormat = "2006-01-02T15:04:05.000000-0700"
+
+// JournalEntry is a log entry read from journalctl in JSON format, it maps the names
+// of the journal fields to their values
+// Ref: https://www.freedesktop.org/software/systemd/man/latest/systemd.journal-fields.html
+type JournalEntry map[string]string
+
+// parseJournalEntry parses a line of journalctl --output=json
+func parseJournalEntry(line []byte) (JournalEntry, error) {
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return nil, err
+	}
+	entry := JournalEntry{}
+	for name, value := range raw {
+		entry[name] = journalFieldValue(value)
+	}
+	return entry, nil
+}
+
+// journalFieldValue converts the value of a journal field to a string. Binary values
+// are encoded as arrays of bytes, fields which are set several times as arrays of values
+// Ref: https://systemd.io/JOURNAL_EXPORT_FORMATS/#journal-json-format
+func journalFieldValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		if len(v) == 0 {
+			return ""
+		}
+		if _, ok := v[0].(float64); ok {
+			data := make([]byte, 0, len(v))
+			for _, b := range v {
+				number, _ := b.(float64)
+				data = append(data, byte(number))
+			}
+			return string(data)
+		}
+		// journalctl shows the last value
+		return journalFieldValue(v[len(v)-1])
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Cursor returns the position of the entry in the journal
+func (e JournalEntry) Cursor() string {
+	return e["__CURSOR"]
+}
+
+// Time returns the time the entry was received by the journal
+func (e JournalEntry) Time() (time.Time, bool) {
+	usec, err := strconv.ParseInt(e["__REALTIME_TIMESTAMP"], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMicro(usec), true
+}
+
+// Unit returns the systemd unit which produced the entry
+func (e JournalEntry) Unit() string {
+	for _, name := range []string{"_SYSTEMD_UNIT", "_SYSTEMD_USER_UNIT", "UNIT"} {
+		if e[name] != "" {
+			return e[name]
+		}
+	}
+	return ""
+}
+
+// Identifier returns the syslog identifier of the entry, e.g. sshd
+func (e JournalEntry) Identifier() string {
+	if e["SYSLOG_IDENTIFIER"] != "" {
+		return e["SYSLOG_IDENTIFIER"]
+	}
+	return e["_COMM"]
+}
+
+// Priority returns the syslog priority of the entry, from 0 (emerg) to 7 (debug). Entries
+// without priority are treated as info
+func (e JournalEntry) Priority() int {
+	priority, err := strconv.Atoi(e["PRIORITY"])
+	if err != nil {
+		return 6
+	}
+	return priority
+}
+
+// blobSizeUnits are the units of the size of binary messages, as printed by journalctl
+var blobSizeUnits = []string{"K", "M", "G", "T", "P", "E"}
+
+// formatBlobSize formats the size of a binary message as journalctl does, e.g. 15B or 1.9K.
+// The fraction is truncated, not rounded
+func formatBlobSize(size int) string {
+	unit := ""
+	factor := 1
+	for _, u := range blobSizeUnits {
+		if size < factor*1024 {
+			break
+		}
+		factor *= 1024
+		unit = u
+	}
+	if unit == "" {
+		return fmt.Sprintf("%dB", size)
+	}
+	return fmt.Sprintf("%d.%d%s", size/factor, size*10/factor%10, unit)
+}
+
+// stripTabANSI expands tabs and removes ANSI colour sequences (ESC [ ... m) and
+// terminal titles (ESC ] ... BEL) from the message as journalctl does. Other escape
+// sequences are kept
+func stripTabANSI(message string) string {
+	b := strings.Builder{}
+	for i := 0; i < len(message); i++ {
+		switch {
+		case message[i] == '\t':
+			b.WriteString("        ")
+		case message[i] == '\x1b' && i+1 < len(message) && message[i+1] == '[':
+			end := i + 2
+			for end < len(message) && (message[end] >= '0' && message[end] <= '9' || message[end] == ';') {
+				end++
+			}
+			if end < len(message) && message[end] == 'm' {
+				i = end
+				continue
+			}
+			b.WriteByte(message[i])
+		case message[i] == '\x1b' && i+1 < len(message) && message[i+1] == ']':
+			end := i + 2
+			for end < len(message) && message[end] >= ' ' && message[end] < 0x7f {
+				end++
+			}
+			if end < len(message) && message[end] == '\a' {
+				i = end
+				continue
+			}
+			b.WriteByte(message[i])
+		default:
+			b.WriteByte(message[i])
+		}
+	}
+	return b.String()
+}
+
+// isPrintable returns true if the message is valid UTF-8 without control characters
+// other than tabs and new lines. journalctl prints other messages as binary
+func isPrintable(message string) bool {
+	if !utf8.ValidString(message) {
+		return false
+	}
+	for _, r := range message {
+		if (r < ' ' && r != '\t' && r != '\n') || (r >= 0x7f && r <= 0x9f) {
+			return false
+		}
+	}
+	return true
+}
+
+// Format formats the entry as a line of journalctl --output=short-iso-precise --utc:
+// the time the message was sent, the host, the identifier with the PID and the message.
+// The following lines of a multiline message are indented as journalctl does, binary
+// messages are replaced with their size
+func (e JournalEntry) Format() string {
+	timestamp := "-"
+	usec, err := strconv.ParseInt(e["_SOURCE_REALTIME_TIMESTAMP"], 10, 64)
+	if err != nil {
+		usec, err = strconv.ParseInt(e["__REALTIME_TIMESTAMP"], 10, 64)
+	}
+	if err == nil {
+		timestamp = time.UnixMicro(usec).UTC().Format(journalTimeFormat)
+	}
+	prefix := timestamp
+	if e["_HOSTNAME"] != "" {
+		prefix += " " + e["_HOSTNAME"]
+	}
+	identifier := e.Identifier()
+	if identifier == "" {
+		identifier = "unknown"
+	}
+	prefix += " " + identifier
+	pid := e["_PID"]
+	if pid == "" {
+		pid = e["SYSLOG_PID"]
+	}
+	if pid != "" {
+		prefix += "[" + pid + "]"
+	}
+	prefix += ": "
+
+	message := stripTabANSI(e["MESSAGE"])
+	if !isPrintable(message) {
+		return prefix + "[" + formatBlobSize(len(message)) + " blob data]"
+	}
+	message = strings.TrimSuffix(message, "\n")
+	return prefix + strings.ReplaceAll(message, "\n", "\n"+strings.Repeat(" ", len(prefix)))
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestJournalEntryFormat compares the formatted entries with the output of journalctl for
+// the same entries. testdata/journal.json and testdata/journal.short-iso-precise were
+// produced by journalctl --output=json and --output=short-iso-precise --utc of systemd 252:
+// multiline, binary, coloured and tabbed messages, kernel messages and repeated fields
+func TestJournalEntryFormat(t *testing.T) {
+	input, err := os.ReadFile("testdata/journal.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile("testdata/journal.short-iso-precise")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Entries are compared one by one, the following lines of a message start with spaces
+	expectedEntries := []string{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(expected), "\n"), "\n") {
+		if strings.HasPrefix(line, " ") && len(expectedEntries) > 0 {
+			expectedEntries[len(expectedEntries)-1] += "\n" + line
+			continue
+		}
+		expectedEntries = append(expectedEntries, line)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(input), []byte("\n"))
+	if len(lines) != len(expectedEntries) {
+		t.Fatalf("%d entries in journal.json, %d in journal.short-iso-precise", len(lines), len(expectedEntries))
+	}
+	for i, line := range lines {
+		entry, err := parseJournalEntry(line)
+		if err != nil {
+			t.Fatalf("entry %d: %s", i, err)
+		}
+		if got := entry.Format(); got != expectedEntries[i] {
+			t.Errorf("entry %d:\n got: %q\nwant: %q", i, got, expectedEntries[i])
+		}
+	}
+}
+
+func TestJournalEntryFormatFallbacks(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry JournalEntry
+		want  string
+	}{
+		{
+			name:  "received time without source time",
+			entry: JournalEntry{"__REALTIME_TIMESTAMP": "1700000000123456", "_HOSTNAME": "web", "SYSLOG_IDENTIFIER": "app", "MESSAGE": "hi"},
+			want:  "2023-11-14T22:13:20.123456+0000 web app: hi",
+		},
+		{
+			name:  "syslog PID without PID",
+			entry: JournalEntry{"__REALTIME_TIMESTAMP": "1700000000123456", "_HOSTNAME": "web", "SYSLOG_IDENTIFIER": "app", "SYSLOG_PID": "7", "MESSAGE": "hi"},
+			want:  "2023-11-14T22:13:20.123456+0000 web app[7]: hi",
+		},
+		{
+			name:  "no identifier and no host",
+			entry: JournalEntry{"__REALTIME_TIMESTAMP": "1700000000123456", "MESSAGE": "hi"},
+			want:  "2023-11-14T22:13:20.123456+0000 unknown: hi",
+		},
+		{
+			name:  "no time",
+			entry: JournalEntry{"_HOSTNAME": "web", "_COMM": "cat", "MESSAGE": "hi"},
+			want:  "- web cat: hi",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.entry.Format(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatBlobSize(t *testing.T) {
+	tests := []struct {
+		size int
+		want string
+	}{
+		{0, "0B"},
+		{15, "15B"},
+		{1023, "1023B"},
+		{1024, "1.0K"},
+		{2000, "1.9K"},
+		{5 * 1024 * 1024, "5.0M"},
+	}
+	for _, test := range tests {
+		if got := formatBlobSize(test.size); got != test.want {
+			t.Errorf("formatBlobSize(%d) = %q, want %q", test.size, got, test.want)
+		}
+	}
+}
+
+func TestJournalFieldValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"string", "sshd", "sshd"},
+		{"null", nil, ""},
+		{"bytes", []interface{}{float64('o'), float64('k'), float64(0xff)}, "ok\xff"},
+		{"repeated", []interface{}{"first", "second"}, "second"},
+		{"empty array", []interface{}{}, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := journalFieldValue(test.value); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStripTabANSI(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{"tabs", "a\tb", "a        b"},
+		{"colours", "\x1b[1;31mred\x1b[m", "red"},
+		{"title", "\x1b]0;title\a text", " text"},
+		{"other sequence", "\x1b[2K text", "\x1b[2K text"},
+		{"title terminated with ST", "\x1b]0;t\x1b\\ x", "\x1b]0;t\x1b\\ x"},
+		{"unterminated", "end \x1b[31", "end \x1b[31"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := stripTabANSI(test.message); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// journalLine returns a line of journalctl --output=json
+func journalLine(cursor, unit, message string) string {
+	return fmt.Sprintf(`{"__CURSOR":%q,"__REALTIME_TIMESTAMP":"1700000000000000","_HOSTNAME":"web","SYSLOG_IDENTIFIER":"app","_SYSTEMD_UNIT":%q,"MESSAGE":%q}`, cursor, unit, message)
+}
+
+// processTestLogs processes the lines with a reader in a temporary directory and returns
+// the batch files it created
+func processTestLogs(t *testing.T, reader *JournalReader, lines []string) []string {
+	t.Helper()
+	UploadQueue = Queue{}
+	logs := []byte(strings.Join(lines, "\n") + "\n")
+	if err := reader.processLogs(&logs); err != nil {
+		t.Fatal(err)
+	}
+	files, err := batchFilesIn(reader.workingDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestProcessLogsSplitsBatchesByMetadata(t *testing.T) {
+	metadata, err := NewMetadataRenderer("prod/{{unit}}", "", "", nil, []string{"unit=sshd.service;destination=security"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := &JournalReader{workingDir: t.TempDir(), counter: initialCounter, since: time.Now(), metadata: metadata}
+	files := processTestLogs(t, reader, []string{
+		journalLine("c1", "nginx.service", "GET /"),
+		journalLine("c2", "sshd.service", "Accepted publickey"),
+		journalLine("c3", "nginx.service", "GET /health"),
+		`{"__CURSOR": broken`,
+		journalLine("c4", "cron.service", "job done"),
+	})
+
+	type batch struct {
+		category    string
+		destination string
+		entries     int
+	}
+	got := []batch{}
+	for _, file := range files {
+		entries, summary, err := readBatchFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, batch{summary.Metadata.Category, summary.Metadata.DestinationName(), len(entries)})
+	}
+	// Batches are created in the order of their first entry, the broken line is sent
+	// as it is with the metadata of an empty entry
+	want := []batch{
+		{"prod/nginx.service", defaultDestination, 2},
+		{"prod/sshd.service", "security", 1},
+		{"prod/", defaultDestination, 1},
+		{"prod/cron.service", defaultDestination, 1},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("batches:\n got: %v\nwant: %v", got, want)
+	}
+	if UploadQueue.Len() != len(want) {
+		t.Errorf("%d files queued, want %d", UploadQueue.Len(), len(want))
+	}
+
+	cursor, err := os.ReadFile(path.Join(reader.workingDir, cursorFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cursor) != "c4" {
+		t.Errorf("cursor is %q, want c4", cursor)
+	}
+}
+
+func TestProcessLogsKeepsUnparsableLines(t *testing.T) {
+	reader := &JournalReader{workingDir: t.TempDir(), counter: initialCounter, since: time.Now()}
+	files := processTestLogs(t, reader, []string{
+		journalLine("c1", "nginx.service", "first"),
+		`not json`,
+		journalLine("c2", "nginx.service", "second"),
+	})
+	if len(files) != 1 {
+		t.Fatalf("%d batch files, want 1", len(files))
+	}
+	entries, _, err := readBatchFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[1] != "not json" {
+		t.Errorf("entries: %q", entries)
+	}
+}
+
+func TestProcessLogsSplitsLargeBatches(t *testing.T) {
+	reader := &JournalReader{workingDir: t.TempDir(), counter: initialCounter, since: time.Now()}
+	lines := []string{}
+	message := strings.Repeat("x", 100*1024)
+	for i := 0; i < 20; i++ {
+		lines = append(lines, journalLine(fmt.Sprintf("c%d", i), "app.service", message))
+	}
+	files := processTestLogs(t, reader, lines)
+
+	// 2 MB of logs are split into batches just over batchSize
+	total := 0
+	for _, file := range files {
+		entries, summary, err := readBatchFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.DecompressedSize > batchSize+len(message)+200 {
+			t.Errorf("%s is %d bytes", file, summary.DecompressedSize)
+		}
+		total += len(entries)
+	}
+	if len(files) != 3 || total != len(lines) {
+		t.Errorf("%d entries in %d files, want %d entries in 3 files", total, len(files), len(lines))
+	}
+}
+
+func TestProcessLogsWithoutCursor(t *testing.T) {
+	reader := &JournalReader{workingDir: t.TempDir(), counter: initialCounter, since: time.Now()}
+	UploadQueue = Queue{}
+	logs := []byte("not json\n")
+	if err := reader.processLogs(&logs); err == nil {
+		t.Error("no error without a cursor")
+	}
+	if _, err := os.Stat(path.Join(reader.workingDir, cursorFilename)); !os.IsNotExist(err) {
+		t.Errorf("cursor file was written: %v", err)
+	}
+}
+
+func TestShouldReadNewLogs(t *testing.T) {
+	tests := []struct {
+		name         string
+		destinations map[string]string
+		failing      []string
+		units        []string // Units of the waiting batch files
+		want         bool
+	}{
+		{name: "no batch files", want: true},
+		{name: "default batch waiting", units: []string{"nginx.service"}, want: false},
+		{
+			name:         "batch of a healthy destination waiting",
+			destinations: map[string]string{"security": "http://security"},
+			units:        []string{"sshd.service"},
+			want:         false,
+		},
+		{
+			name:         "only batches of a failing destination waiting",
+			destinations: map[string]string{"security": "http://security"},
+			failing:      []string{"security"},
+			units:        []string{"sshd.service", "sshd.service"},
+			want:         true,
+		},
+		{
+			name:         "batches of failing and healthy destinations waiting",
+			destinations: map[string]string{"security": "http://security"},
+			failing:      []string{"security"},
+			units:        []string{"sshd.service", "nginx.service"},
+			want:         false,
+		},
+		{
+			name:    "failing default destination without routes",
+			failing: []string{defaultDestination},
+			units:   []string{"nginx.service"},
+			want:    false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previousDestinations, previousStates := Destinations, FailingDestinations
+			t.Cleanup(func() {
+				FailingDestinations = previousStates
+				setDestinations(previousDestinations)
+			})
+			setDestinations(test.destinations)
+			FailingDestinations = &DestinationStates{}
+			for _, destination := range test.failing {
+				FailingDestinations.SetFailing(destination, true)
+			}
+
+			metadata, err := NewMetadataRenderer("", "", "", nil, []string{"unit=sshd.service;destination=security"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader := &JournalReader{workingDir: t.TempDir(), counter: initialCounter, since: time.Now(), metadata: metadata}
+			for i, unit := range test.units {
+				processTestLogs(t, reader, []string{journalLine(fmt.Sprintf("c%d", i), unit, "message")})
+			}
+			// The reader starts again, e.g. after a restart
+			reader.counter = initialCounter
+			UploadQueue = Queue{}
+			if got := reader.shouldReadNewLogs(); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+			if UploadQueue.Len() != len(test.units) {
+				t.Errorf("%d files queued, want %d", UploadQueue.Len(), len(test.units))
+			}
+			if reader.counter != initialCounter+len(test.units) {
+				t.Errorf("counter is %d, want %d", reader.counter, initialCounter+len(test.units))
+			}
+		})
+	}
+}
+
+func TestProcessLogsKeepsWaitingBatches(t *testing.T) {
+	reader := &JournalReader{workingDir: t.TempDir(), counter: initialCounter, since: time.Now()}
+	waiting := processTestLogs(t, reader, []string{journalLine("c1", "sshd.service", "waiting")})
+	reader.counter = initialCounter
+	if reader.shouldReadNewLogs() {
+		t.Fatal("logs are read while the default batch is waiting")
+	}
+	files := processTestLogs(t, reader, []string{journalLine("c2", "nginx.service", "new")})
+	if len(files) != 2 || files[0] != waiting[0] {
+		t.Fatalf("batch files are %q, want %s and a new one", files, waiting[0])
+	}
+	entries, _, err := readBatchFile(waiting[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !strings.HasSuffix(entries[0], "waiting") {
+		t.Errorf("waiting batch was overwritten: %q", entries)
+	}
+}
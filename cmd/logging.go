@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attributes of log records. Records about the same things use the same attributes, so
+// they can be correlated in SumoLogic, e.g. a batch file from its creation to its upload
+const (
+	attrFile        = "file"
+	attrBytes       = "bytes"
+	attrEntries     = "entries"
+	attrDestination = "destination"
+	attrCategory    = "category"
+	attrReceiver    = "receiver"
+	attrDuration    = "duration"
+	attrInterval    = "interval"
+	attrQueue       = "queue"
+	attrError       = "error"
+)
+
+// noColorEnvVar disables colours if it is set, see https://no-color.org
+const noColorEnvVar = "NO_COLOR"
+
+// coloursEnabled is true if the output of commands is coloured
+var coloursEnabled = useColours(os.Stdout)
+
+// useColours returns true if the output to the file can be coloured: it is a terminal
+// and colours aren't disabled with NO_COLOR
+func useColours(f *os.File) bool {
+	if os.Getenv(noColorEnvVar) != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// errAttr returns the attribute of the error
+func errAttr(err error) slog.Attr {
+	return slog.Any(attrError, err)
+}
+
+// sourceLocation returns the file and the line of the caller of the logger, e.g. journal.go:224
+func sourceLocation(pc uintptr) string {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	return fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+}
+
+// consoleHandler writes log records as text lines: the time, the level, the location,
+// the message and the attributes, e.g.
+// 10:00:00.000000 INFO  journal.go:224: Logs read lines=3
+// The level is coloured if the output is a terminal
+type consoleHandler struct {
+	mu      *sync.Mutex
+	w       io.Writer
+	level   slog.Leveler
+	colours bool
+	prefix  string // Prefix of the keys of the attributes, set by WithGroup
+	attrs   string // Formatted attributes added with WithAttrs
+}
+
+// Enabled returns true if records of the level are written
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// levelName returns the name of the level padded to the same width, coloured if needed
+func (h *consoleHandler) levelName(level slog.Level) string {
+	name := fmt.Sprintf("%-5s", level.String())
+	if !h.colours {
+		return name
+	}
+	switch {
+	case level >= slog.LevelError:
+		return RedColor + name + ResetColor
+	case level >= slog.LevelWarn:
+		return YellowColor + name + ResetColor
+	case level >= slog.LevelInfo:
+		return GreenColor + name + ResetColor
+	default:
+		return BlueColor + name + ResetColor
+	}
+}
+
+// appendAttr formats the attribute as key=value, values with spaces or quotes are quoted
+func (h *consoleHandler) appendAttr(b *strings.Builder, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, groupAttr := range attr.Value.Group() {
+			h.appendAttr(b, prefix, groupAttr)
+		}
+		return
+	}
+	var value string
+	switch attr.Value.Kind() {
+	case slog.KindTime:
+		value = attr.Value.Time().Format(time.RFC3339)
+	default:
+		value = fmt.Sprint(attr.Value.Any())
+	}
+	if value == "" || strings.ContainsAny(value, " \"=\n\t") {
+		value = strconv.Quote(value)
+	}
+	b.WriteString(" " + prefix + attr.Key + "=" + value)
+}
+
+// Handle writes the record
+func (h *consoleHandler) Handle(_ context.Context, record slog.Record) error {
+	b := &strings.Builder{}
+	b.WriteString(record.Time.Format("15:04:05.000000"))
+	b.WriteString(" " + h.levelName(record.Level))
+	if record.PC != 0 {
+		b.WriteString(" " + sourceLocation(record.PC) + ":")
+	}
+	b.WriteString(" " + record.Message)
+	b.WriteString(h.attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		h.appendAttr(b, h.prefix, attr)
+		return true
+	})
+	b.WriteString("\n")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+// WithAttrs returns the handler which adds the attributes to all records
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	b := &strings.Builder{}
+	for _, attr := range attrs {
+		h.appendAttr(b, h.prefix, attr)
+	}
+	clone.attrs += b.String()
+	return &clone
+}
+
+// WithGroup returns the handler which adds the group to the keys of the attributes
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix += name + "."
+	return &clone
+}
+
+// logFormats are the supported values of --log-format
+var logFormats = []string{"text", "json"}
+
+// newLogger creates the logger writing to the file in the format: text or json. The time,
+// the level and the location are added to all records
+func newLogger(f *os.File, format, level string) (*slog.Logger, error) {
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q, use debug, info, warn or error", level)
+	}
+	switch format {
+	case "text":
+		return slog.New(&consoleHandler{mu: &sync.Mutex{}, w: f, level: logLevel, colours: useColours(f)}), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(f, &slog.HandlerOptions{
+			AddSource: true,
+			Level:     logLevel,
+			ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+				// The location is shortened as in the text format
+				if source, ok := attr.Value.Any().(*slog.Source); ok && attr.Key == slog.SourceKey && len(groups) == 0 {
+					return slog.String(slog.SourceKey, fmt.Sprintf("%s:%d", filepath.Base(source.File), source.Line))
+				}
+				return attr
+			},
+		})), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, use %s", format, strings.Join(logFormats, " or "))
+	}
+}
+
+// setupLogger sets the logger writing to the file, as configured with --log-format,
+// --log-level and --debug
+func setupLogger(f *os.File) error {
+	level := FlagLogLevel
+	if FlagDebug {
+		level = "debug"
+	}
+	logger, err := newLogger(f, FlagLogFormat, level)
+	if err != nil {
+		return err
+	}
+	Logger = logger
+	return nil
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+// newTestSumoAPI points SumoAPI to a test server with the handler. Failed requests aren't
+// retried, so tests of server errors don't wait
+func newTestSumoAPI(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	t.Setenv(sumoAccessIDEnvVar, "id")
+	t.Setenv(sumoAccessKeyEnvVar, "key")
+	previous := SumoAPI
+	t.Cleanup(func() { SumoAPI = previous })
+	SumoAPI = NewSumoClient(NewCredentialChain(""))
+	SumoAPI.BaseURL = server.URL
+	SumoAPI.Hook = nil
+	SumoAPI.MaxRetries = 0
+	return server
+}
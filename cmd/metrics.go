@@ -24,3 +24,54 @@ var metricErrorsWhenSendingToReceiver = promauto.NewCounter(prometheus.CounterOp
 	Name: "jsumo_errors_sending_to_receiver_total",
 	Help: "The total number of errors when sending logs to the receiver",
 })
+
+var metricReceiverSwitches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "jsumo_receiver_switches_total",
+	Help: "The total number of switches between receivers",
+}, []string{"reason"})
+
+var metricActiveReceiver = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "jsumo_active_receiver",
+	Help: "The index of the active receiver, 0 is the primary receiver",
+})
+
+var metricReceiverURLChanges = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "jsumo_receiver_url_changes_total",
+	Help: "The total number of times the primary receiver URL was resolved to a new value",
+})
+
+var metricCanaryLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "jsumo_canary_latency_seconds",
+	Help:    "The time from writing a canary message to the journal until it was read, uploaded or found in SumoLogic",
+	Buckets: []float64{1, 2, 5, 10, 20, 30, 60, 120, 300, 600},
+}, []string{"stage"})
+
+var metricCanaryResults = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "jsumo_canary_total",
+	Help: "The total number of canary messages by the result of the delivery",
+}, []string{"result"})
+
+var metricCanaryLastSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "jsumo_canary_last_success_timestamp_seconds",
+	Help: "The time of the last successfully delivered canary message",
+})
+
+var metricMetricsForwardErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "jsumo_errors_forwarding_metrics_total",
+	Help: "The total number of errors when forwarding metrics to the metrics receiver",
+})
+
+var metricRoutedLines = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "jsumo_routed_lines_total",
+	Help: "The total number of lines read from journalctl by their destination",
+}, []string{"destination"})
+
+var metricUploadsPaused = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "jsumo_uploads_paused",
+	Help: "1 if uploads are paused using the admin API",
+})
+
+var metricDroppedBatches = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "jsumo_dropped_batches_total",
+	Help: "The total number of batch files dropped from the upload queue using the admin API",
+})
@@ -0,0 +1,427 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Content types of the metrics formats accepted by SumoLogic HTTP sources
+// Ref: https://help.sumologic.com/docs/send-data/hosted-collectors/http-source/logs-metrics/upload-metrics/
+const contentTypePrometheus = "application/vnd.sumologic.prometheus"
+const contentTypeCarbon2 = "application/vnd.sumologic.carbon2"
+
+// userHZ is the number of clock ticks per second used in /proc/stat
+const userHZ = 100
+
+// MetricsForwarder periodically gathers the metrics and posts them to a SumoLogic
+// HTTP source. All methods are safe to call on a nil forwarder, which means that
+// forwarding of metrics is disabled
+type MetricsForwarder struct {
+	sync.Mutex
+	url             string
+	format          string // prometheus or carbon2
+	gatherer        prometheus.Gatherer
+	autoProvisioned bool // The metrics source is provisioned together with the logs source
+	// provisionErr is the last error of the provisioning of the metrics source, it is
+	// reported in /readyz until the source is provisioned
+	provisionErr     error
+	provisionBackoff time.Duration // First interval between the attempts to provision it
+	retrying         bool
+}
+
+// SetURL sets the URL of the HTTP source which receives the metrics
+func (m *MetricsForwarder) SetURL(url string) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	if m.url != url {
+		Logger.Info("Metrics receiver URL set", attrReceiver, redactReceiverURL(url))
+	}
+	m.url = url
+	m.provisionErr = nil
+}
+
+// ProvisionError returns the error of the provisioning of the metrics source, nil if it
+// is provisioned or wasn't attempted yet
+func (m *MetricsForwarder) ProvisionError() error {
+	if m == nil {
+		return nil
+	}
+	m.Lock()
+	defer m.Unlock()
+	return m.provisionErr
+}
+
+// RetryProvisioning records the failure to provision the metrics source and provisions
+// it again in the background. Failed attempts are retried with exponential backoff until
+// the source is provisioned or the context is cancelled
+func (m *MetricsForwarder) RetryProvisioning(ctx context.Context, err error) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.provisionErr = err
+	if m.retrying {
+		return
+	}
+	m.retrying = true
+	Logger.Error("Unable to provision metrics source, retrying", "in", m.provisionBackoff, errAttr(err))
+	Health.ReportError(err)
+
+	backoff := m.provisionBackoff
+	go func() {
+		defer func() {
+			m.Lock()
+			m.retrying = false
+			m.Unlock()
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if m.ProvisionError() == nil {
+				// Provisioned together with the logs source meanwhile
+				return
+			}
+			url, err := provisionSumoMetricsSource(ctx)
+			if err == nil {
+				m.SetURL(url)
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			backoff = min(backoff*2, provisionMaxBackoff)
+			m.Lock()
+			m.provisionErr = err
+			m.Unlock()
+			Logger.Error("Unable to provision metrics source, retrying", "in", backoff, errAttr(err))
+			Health.ReportError(err)
+		}
+	}()
+}
+
+// AutoProvisioned returns true if the metrics source should be provisioned
+// together with the logs source
+func (m *MetricsForwarder) AutoProvisioned() bool {
+	return m != nil && m.autoProvisioned
+}
+
+// Send gathers the metrics and posts them to the metrics receiver
+func (m *MetricsForwarder) Send(ctx context.Context) error {
+	if m == nil {
+		return nil
+	}
+	m.Lock()
+	receiverURL := m.url
+	m.Unlock()
+	if receiverURL == "" {
+		Logger.Debug("Metrics receiver URL is not resolved yet, skipping")
+		return nil
+	}
+
+	families, err := m.gatherer.Gather()
+	if err != nil {
+		// Partial results are still worth sending
+		Logger.Error("Unable to gather some metrics", errAttr(err))
+	}
+	body, contentType, err := encodeMetrics(families, m.format, time.Now())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", receiverURL, bytes.NewReader(body))
+	if err != nil {
+		return redactURLError(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	Logger.Debug("Making request", "method", http.MethodPost, attrReceiver, redactReceiverURL(receiverURL), attrBytes, len(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return redactURLError(err)
+	}
+	defer resp.Body.Close()
+	Logger.Debug("Response received", "status", resp.Status)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &ReceiverError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(respBody)}
+	}
+	return nil
+}
+
+// Start sends the metrics every interval
+func (m *MetricsForwarder) Start(ctx context.Context, interval time.Duration) {
+	if m == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.Send(ctx); err != nil {
+					metricMetricsForwardErrors.Inc()
+					Logger.Error("Unable to forward metrics", errAttr(err))
+				}
+			}
+		}
+	}()
+}
+
+// NewMetricsForwarder creates a new metrics forwarder. If the URL is empty, the metrics
+// source is provisioned together with the logs source. If node is true, the host
+// stats from /proc are forwarded together with jsumo metrics
+func NewMetricsForwarder(url, format string, node bool) (*MetricsForwarder, error) {
+	if format != "prometheus" && format != "carbon2" {
+		return nil, fmt.Errorf("unknown metrics format %q, expected prometheus or carbon2", format)
+	}
+	gatherers := prometheus.Gatherers{prometheus.DefaultGatherer}
+	if node {
+		registry := prometheus.NewRegistry()
+		if err := registry.Register(nodeCollector{}); err != nil {
+			return nil, err
+		}
+		gatherers = append(gatherers, registry)
+	}
+	return &MetricsForwarder{
+		url:              url,
+		format:           format,
+		gatherer:         gatherers,
+		autoProvisioned:  url == "",
+		provisionBackoff: provisionMinBackoff,
+	}, nil
+}
+
+// encodeMetrics encodes the metric families in the given format and returns the body
+// of the request together with its content type
+func encodeMetrics(families []*dto.MetricFamily, format string, now time.Time) ([]byte, string, error) {
+	buffer := bytes.Buffer{}
+	if format == "prometheus" {
+		for _, family := range families {
+			if _, err := expfmt.MetricFamilyToText(&buffer, family); err != nil {
+				return nil, "", err
+			}
+		}
+		return buffer.Bytes(), contentTypePrometheus, nil
+	}
+
+	for _, family := range families {
+		for _, sample := range flattenMetricFamily(family) {
+			if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+				continue
+			}
+			buffer.WriteString("metric=" + carbon2Escape(sample.name))
+			for _, label := range sample.labels {
+				buffer.WriteString(fmt.Sprintf(" %s=%s", carbon2Escape(label[0]), carbon2Escape(label[1])))
+			}
+			// Two spaces separate the intrinsic tags from the value
+			buffer.WriteString(fmt.Sprintf("  %s %d\n", strconv.FormatFloat(sample.value, 'g', -1, 64), now.Unix()))
+		}
+	}
+	return buffer.Bytes(), contentTypeCarbon2, nil
+}
+
+// metricSample is a single value of a metric, histograms and summaries are split into
+// several samples with the same naming as in the Prometheus text format
+type metricSample struct {
+	name   string
+	labels [][2]string
+	value  float64
+}
+
+// flattenMetricFamily returns the samples of the metric family
+func flattenMetricFamily(family *dto.MetricFamily) []metricSample {
+	samples := []metricSample{}
+	for _, metric := range family.GetMetric() {
+		labels := [][2]string{}
+		for _, label := range metric.GetLabel() {
+			labels = append(labels, [2]string{label.GetName(), label.GetValue()})
+		}
+		with := func(name, value string) [][2]string {
+			return append(append([][2]string{}, labels...), [2]string{name, value})
+		}
+		name := family.GetName()
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			samples = append(samples, metricSample{name, labels, metric.GetCounter().GetValue()})
+		case dto.MetricType_GAUGE:
+			samples = append(samples, metricSample{name, labels, metric.GetGauge().GetValue()})
+		case dto.MetricType_UNTYPED:
+			samples = append(samples, metricSample{name, labels, metric.GetUntyped().GetValue()})
+		case dto.MetricType_HISTOGRAM:
+			histogram := metric.GetHistogram()
+			for _, bucket := range histogram.GetBucket() {
+				samples = append(samples, metricSample{name + "_bucket", with("le", strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64)), float64(bucket.GetCumulativeCount())})
+			}
+			samples = append(samples, metricSample{name + "_bucket", with("le", "+Inf"), float64(histogram.GetSampleCount())})
+			samples = append(samples, metricSample{name + "_sum", labels, histogram.GetSampleSum()})
+			samples = append(samples, metricSample{name + "_count", labels, float64(histogram.GetSampleCount())})
+		case dto.MetricType_SUMMARY:
+			summary := metric.GetSummary()
+			for _, quantile := range summary.GetQuantile() {
+				samples = append(samples, metricSample{name, with("quantile", strconv.FormatFloat(quantile.GetQuantile(), 'g', -1, 64)), quantile.GetValue()})
+			}
+			samples = append(samples, metricSample{name + "_sum", labels, summary.GetSampleSum()})
+			samples = append(samples, metricSample{name + "_count", labels, float64(summary.GetSampleCount())})
+		}
+	}
+	return samples
+}
+
+// carbon2Escape replaces the characters which separate tags in Carbon2 format
+func carbon2Escape(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return strings.NewReplacer(" ", "_", "=", ":").Replace(value)
+}
+
+// nodeCollector collects the host stats from /proc, named as in node_exporter
+type nodeCollector struct{}
+
+var (
+	nodeLoadDescs = []*prometheus.Desc{
+		prometheus.NewDesc("node_load1", "1m load average", nil, nil),
+		prometheus.NewDesc("node_load5", "5m load average", nil, nil),
+		prometheus.NewDesc("node_load15", "15m load average", nil, nil),
+	}
+	nodeMemoryFields = []string{"MemTotal", "MemFree", "MemAvailable", "Buffers", "Cached", "SwapTotal", "SwapFree"}
+	nodeMemoryDescs  = map[string]*prometheus.Desc{}
+	nodeCPUDesc      = prometheus.NewDesc("node_cpu_seconds_total", "Seconds the CPUs spent in each mode", []string{"mode"}, nil)
+	nodeCPUModes     = []string{"user", "nice", "system", "idle", "iowait", "irq", "softirq", "steal"}
+)
+
+func init() {
+	for _, field := range nodeMemoryFields {
+		nodeMemoryDescs[field] = prometheus.NewDesc(fmt.Sprintf("node_memory_%s_bytes", field), fmt.Sprintf("Memory information field %s from /proc/meminfo", field), nil, nil)
+	}
+}
+
+func (c nodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range nodeLoadDescs {
+		ch <- desc
+	}
+	for _, field := range nodeMemoryFields {
+		ch <- nodeMemoryDescs[field]
+	}
+	ch <- nodeCPUDesc
+}
+
+func (c nodeCollector) Collect(ch chan<- prometheus.Metric) {
+	if err := collectNodeLoad(ch); err != nil {
+		Logger.Debug("Unable to read load average", errAttr(err))
+	}
+	if err := collectNodeMemory(ch); err != nil {
+		Logger.Debug("Unable to read memory information", errAttr(err))
+	}
+	if err := collectNodeCPU(ch); err != nil {
+		Logger.Debug("Unable to read CPU stats", errAttr(err))
+	}
+}
+
+// collectNodeLoad reads the load averages from /proc/loadavg
+func collectNodeLoad(ch chan<- prometheus.Metric) error {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < len(nodeLoadDescs) {
+		return fmt.Errorf("unexpected content of /proc/loadavg: %q", string(data))
+	}
+	for i, desc := range nodeLoadDescs {
+		value, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return err
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+	}
+	return nil
+}
+
+// collectNodeMemory reads the memory information from /proc/meminfo
+func collectNodeMemory(ch chan<- prometheus.Metric) error {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// MemTotal:       16303724 kB
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		desc, ok := nodeMemoryDescs[strings.TrimSuffix(fields[0], ":")]
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return err
+		}
+		if len(fields) == 3 && fields[2] == "kB" {
+			value *= 1024
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+	}
+	return scanner.Err()
+}
+
+// collectNodeCPU reads the time spent by all CPUs from /proc/stat
+func collectNodeCPU(ch chan<- prometheus.Metric) error {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// cpu  10132153 290696 3084719 46828483 16683 0 25195 0 0 0
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "cpu" {
+			continue
+		}
+		for i, mode := range nodeCPUModes {
+			if i+1 >= len(fields) {
+				break
+			}
+			ticks, err := strconv.ParseFloat(fields[i+1], 64)
+			if err != nil {
+				return err
+			}
+			ch <- prometheus.MustNewConstMetric(nodeCPUDesc, prometheus.CounterValue, ticks/userHZ, mode)
+		}
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("cpu line not found in /proc/stat")
+}
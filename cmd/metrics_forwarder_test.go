@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMetricsSource is the SumoLogic API of a collector without the metrics source.
+// Creating the source fails the given number of times
+type fakeMetricsSource struct {
+	sync.Mutex
+	failures int
+	created  int
+}
+
+func (f *fakeMetricsSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/collectors/1/sources":
+		json.NewEncoder(w).Encode(map[string]interface{}{"sources": []interface{}{}})
+	case r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(map[string]interface{}{"collector": map[string]interface{}{"id": 1}})
+	case r.Method == http.MethodPost && f.failures > 0:
+		f.failures--
+		http.Error(w, `{"code": "internal", "message": "failed"}`, http.StatusInternalServerError)
+	case r.Method == http.MethodPost:
+		f.created++
+		json.NewEncoder(w).Encode(map[string]interface{}{"source": map[string]interface{}{"id": 2, "url": "https://collectors/receiver/v1/http/metrics"}})
+	}
+}
+
+func TestMetricsForwarderRetryProvisioning(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		cancel   bool
+		wantURL  string
+	}{
+		{name: "provisioned on retry", wantURL: "https://collectors/receiver/v1/http/metrics"},
+		{name: "provisioned after failed retries", failures: 3, wantURL: "https://collectors/receiver/v1/http/metrics"},
+		{name: "cancelled", failures: 1000, cancel: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &fakeMetricsSource{failures: test.failures}
+			newTestSumoAPI(t, api)
+			forwarder, err := NewMetricsForwarder("", "prometheus", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			forwarder.provisionBackoff = time.Millisecond
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			forwarder.RetryProvisioning(ctx, errors.New("initial failure"))
+			if forwarder.ProvisionError() == nil {
+				t.Fatal("failure not recorded")
+			}
+			if test.cancel {
+				cancel()
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				forwarder.Lock()
+				url, retrying := forwarder.url, forwarder.retrying
+				forwarder.Unlock()
+				if !retrying {
+					if url != test.wantURL {
+						t.Errorf("URL is %q, want %q", url, test.wantURL)
+					}
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("still retrying")
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			gotErr := forwarder.ProvisionError()
+			if test.wantURL != "" && gotErr != nil {
+				t.Errorf("error %v left after provisioning", gotErr)
+			}
+			if test.wantURL == "" && gotErr == nil {
+				t.Error("error cleared without provisioning")
+			}
+			api.Lock()
+			defer api.Unlock()
+			if test.wantURL != "" && api.created != 1 {
+				t.Errorf("metrics source created %d times, want 1", api.created)
+			}
+		})
+	}
+}
+
+func TestMetricsForwarderRetryProvisioningOnce(t *testing.T) {
+	// Repeated failures while retrying don't start more retry loops
+	forwarder := &MetricsForwarder{provisionBackoff: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	forwarder.RetryProvisioning(ctx, errors.New("first"))
+	forwarder.RetryProvisioning(ctx, errors.New("second"))
+	if got := forwarder.ProvisionError(); got == nil || got.Error() != "second" {
+		t.Errorf("error is %v, want the last one", got)
+	}
+	forwarder.SetURL("https://collectors/receiver/v1/http/metrics")
+	if got := forwarder.ProvisionError(); got != nil {
+		t.Errorf("error %v left after the URL was set", got)
+	}
+}
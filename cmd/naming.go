@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// machineIDFile is the file with the unique ID of the machine
+// Ref: https://www.freedesktop.org/software/systemd/man/latest/machine-id.html
+const machineIDFile = "/etc/machine-id"
+
+// defaultNameTemplate is the default template for the collector and source names
+const defaultNameTemplate = "{{.Hostname}}"
+
+// NamingData is the data available in the naming templates, e.g.
+// "{{.Vars.role}}-{{.Hostname}}" or "{{env \"ENVIRONMENT\"}}/{{.MachineID}}"
+type NamingData struct {
+	Hostname  string
+	MachineID string
+	Vars      map[string]string
+}
+
+// SumoNames are the rendered names of the objects in SumoLogic
+type SumoNames struct {
+	Collector     string
+	Source        string
+	MetricsSource string
+	Category      string
+	HostName      string
+}
+
+// namingFuncs are the functions available in the naming templates
+var namingFuncs = template.FuncMap{
+	"env":   os.Getenv,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// getNamingData collects the data for the naming templates
+func getNamingData() (NamingData, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return NamingData{}, err
+	}
+	Logger.Debug("System hostname", "hostname", hostname)
+
+	machineID, err := os.ReadFile(machineIDFile)
+	if err != nil {
+		Logger.Debug("Unable to read machine ID", errAttr(err))
+	}
+
+	vars := FlagTemplateVars
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	return NamingData{
+		Hostname:  hostname,
+		MachineID: strings.TrimSpace(string(machineID)),
+		Vars:      vars,
+	}, nil
+}
+
+// renderName renders the naming template. The result can't be empty
+func renderName(what, text string, data NamingData) (string, error) {
+	tmpl, err := template.New(what).Funcs(namingFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", what, err)
+	}
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, data); err != nil {
+		return "", fmt.Errorf("unable to render %s template: %w", what, err)
+	}
+	name := strings.TrimSpace(buffer.String())
+	if name == "" {
+		return "", fmt.Errorf("%s template %q rendered to an empty string", what, text)
+	}
+	return name, nil
+}
+
+// renderSumoNames renders the names of the collector and the source from the templates
+func renderSumoNames() (SumoNames, error) {
+	data, err := getNamingData()
+	if err != nil {
+		return SumoNames{}, err
+	}
+
+	names := SumoNames{}
+	for _, t := range []struct {
+		what   string
+		text   string
+		target *string
+	}{
+		{"collector name", FlagCollectorName, &names.Collector},
+		{"source name", FlagSourceName, &names.Source},
+		{"metrics source name", FlagMetricsSourceName, &names.MetricsSource},
+		{"source category", FlagSourceCategoryName, &names.Category},
+		{"source host", FlagSourceHost, &names.HostName},
+	} {
+		*t.target, err = renderName(t.what, t.text, data)
+		if err != nil {
+			return SumoNames{}, err
+		}
+	}
+	Logger.Debug("Rendered names", "names", fmt.Sprintf("%+v", names))
+	return names, nil
+}
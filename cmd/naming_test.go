@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRenderName(t *testing.T) {
+	t.Setenv("JSUMO_TEST_ENVIRONMENT", "Prod")
+	data := NamingData{Hostname: "web1", MachineID: "0123abcd", Vars: map[string]string{"role": "frontend"}}
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr string
+	}{
+		{name: "hostname", text: defaultNameTemplate, want: "web1"},
+		{name: "vars", text: "{{.Vars.role}}-{{.Hostname}}", want: "frontend-web1"},
+		{name: "env", text: `{{env "JSUMO_TEST_ENVIRONMENT" | lower}}/{{.MachineID}}`, want: "prod/0123abcd"},
+		{name: "upper", text: "{{upper .Hostname}}", want: "WEB1"},
+		{name: "whitespace trimmed", text: " {{.Hostname}}\n", want: "web1"},
+		{name: "plain text", text: "shared", want: "shared"},
+		{name: "missing var", text: "{{.Vars.missing}}", wantErr: "unable to render collector name template"},
+		{name: "invalid template", text: "{{.Hostname", wantErr: "invalid collector name template"},
+		{name: "unknown function", text: "{{title .Hostname}}", wantErr: "invalid collector name template"},
+		{name: "empty", text: `{{env "JSUMO_TEST_UNSET"}}`, wantErr: "rendered to an empty string"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := renderName("collector name", test.text, data)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRenderSumoNames(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		metrics string
+		vars    map[string]string
+		want    SumoNames
+		wantErr bool
+	}{
+		{
+			name:    "defaults",
+			metrics: defaultNameTemplate + "-metrics",
+			want:    SumoNames{Collector: hostname, Source: hostname, MetricsSource: hostname + "-metrics", Category: hostname, HostName: hostname},
+		},
+		{
+			name:    "vars",
+			metrics: "{{.Vars.role}}-metrics",
+			vars:    map[string]string{"role": "db"},
+			want:    SumoNames{Collector: hostname, Source: hostname, MetricsSource: "db-metrics", Category: hostname, HostName: hostname},
+		},
+		{name: "missing var", metrics: "{{.Vars.role}}-metrics", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flags := []*string{&FlagCollectorName, &FlagSourceName, &FlagMetricsSourceName, &FlagSourceCategoryName, &FlagSourceHost}
+			previous := make([]string, len(flags))
+			for i, flag := range flags {
+				previous[i] = *flag
+				*flag = defaultNameTemplate
+			}
+			previousVars := FlagTemplateVars
+			t.Cleanup(func() {
+				for i, flag := range flags {
+					*flag = previous[i]
+				}
+				FlagTemplateVars = previousVars
+			})
+			FlagMetricsSourceName = test.metrics
+			FlagTemplateVars = test.vars
+
+			got, err := renderSumoNames()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -2,29 +2,31 @@ package cmd
 
 // Collector is the Collector instance in SumoLogic
 type Collector struct {
-	ID            int    `json:"id"`
-	Name          string `json:"name"`
-	Description   string `json:"description"`
-	Category      string `json:"category"`
-	Timezone      string `json:"timezone"`
-	CollectorType string `json:"collectorType"`
+	ID            int               `json:"id"`
+	Name          string            `json:"name"`
+	Description   string            `json:"description"`
+	Category      string            `json:"category"`
+	Timezone      string            `json:"timeZone"`
+	CollectorType string            `json:"collectorType"`
+	Fields        map[string]string `json:"fields,omitempty"`
 }
 
 // Source is the Source instance in SumoLogic
 type Source struct {
-	ID                         int    `json:"id"`
-	Name                       string `json:"name"`
-	Description                string `json:"description"`
-	Category                   string `json:"category"`
-	HostName                   string `json:"hostName"`
-	Timezone                   string `json:"timezone"`
-	SourceType                 string `json:"sourceType"`
-	Encoding                   string `json:"encoding"`
-	ForceTimeZone              bool   `json:"forceTimeZone"`
-	ContentType                string `json:"contentType"`
-	MultilineProcessingEnabled bool   `json:"multilineProcessingEnabled"`
-	AutomaticDateParsing       bool   `json:"automaticDateParsing"`
-	URL                        string `json:"url"`
+	ID                         int               `json:"id"`
+	Name                       string            `json:"name"`
+	Description                string            `json:"description"`
+	Category                   string            `json:"category"`
+	HostName                   string            `json:"hostName"`
+	Timezone                   string            `json:"timeZone"`
+	SourceType                 string            `json:"sourceType"`
+	Encoding                   string            `json:"encoding"`
+	ForceTimeZone              bool              `json:"forceTimeZone"`
+	ContentType                string            `json:"contentType"`
+	MultilineProcessingEnabled bool              `json:"multilineProcessingEnabled"`
+	AutomaticDateParsing       bool              `json:"automaticDateParsing"`
+	URL                        string            `json:"url"`
+	Fields                     map[string]string `json:"fields,omitempty"`
 }
 
 // CollectorResponse is the response from the SumoLogic API when creating a collector
@@ -44,3 +46,38 @@ type SourceResponse struct {
 type SourcesListResponse struct {
 	Sources []Source `json:"sources"`
 }
+
+// SearchJobRequest is the request to create a search job
+// Ref: https://help.sumologic.com/docs/api/search-job/#create-a-search-job
+type SearchJobRequest struct {
+	Query         string `json:"query"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+	TimeZone      string `json:"timeZone"`
+	ByReceiptTime bool   `json:"byReceiptTime"`
+}
+
+// SearchJobResponse is the response from the SumoLogic API when creating a search job
+type SearchJobResponse struct {
+	ID string `json:"id"`
+}
+
+// SearchJobStatus is the status of a search job
+// Ref: https://help.sumologic.com/docs/api/search-job/#get-the-current-search-job-status
+type SearchJobStatus struct {
+	State           string   `json:"state"`
+	MessageCount    int      `json:"messageCount"`
+	RecordCount     int      `json:"recordCount"`
+	PendingErrors   []string `json:"pendingErrors"`
+	PendingWarnings []string `json:"pendingWarnings"`
+}
+
+// SearchMessage is a message found by a search job. The map holds the fields of
+// the message, e.g. _raw, _messagetime, _sourcecategory
+type SearchMessage struct {
+	Map map[string]string `json:"map"`
+}
+
+type SearchMessagesResponse struct {
+	Messages []SearchMessage `json:"messages"`
+}
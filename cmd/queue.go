@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"fmt"
 	"sync"
 )
 
@@ -24,7 +23,7 @@ func (q *Queue) AddFile(filename string) {
 		}
 	}
 	q.filesToUpload = append(q.filesToUpload, filename)
-	DebugLogger.Println(purple(fmt.Sprintf("File %s added to the queue", filename)))
+	Logger.Debug("File added to the queue", attrFile, filename)
 }
 
 // ReturnFile returns a file to the queue
@@ -38,7 +37,7 @@ func (q *Queue) ReturnFile(filename string) {
 		}
 	}
 	q.filesToUpload = append([]string{filename}, q.filesToUpload...)
-	DebugLogger.Println(purple(fmt.Sprintf("File %s returned to the queue", filename)))
+	Logger.Debug("File returned to the queue", attrFile, filename)
 }
 
 // Next returns the next file in the queue
@@ -46,18 +45,40 @@ func (q *Queue) Next() string {
 	q.Lock()
 	defer q.Unlock()
 	if len(q.filesToUpload) == 0 {
-		DebugLogger.Println(purple("No files in the queue"))
+		Logger.Debug("No files in the queue")
 		return ""
 	}
 	file := q.filesToUpload[0]
 	q.filesToUpload = q.filesToUpload[1:]
-	DebugLogger.Println(purple(fmt.Sprintf("File %s taken from the queue", file)))
+	Logger.Debug("File taken from the queue", attrFile, file)
 	return file
 }
 
+// NextWhere returns the first file in the queue which matches, the order of other files
+// is kept. It returns an empty string if no file matches
+func (q *Queue) NextWhere(match func(filename string) bool) string {
+	q.Lock()
+	defer q.Unlock()
+	for i, file := range q.filesToUpload {
+		if match(file) {
+			q.filesToUpload = append(q.filesToUpload[:i:i], q.filesToUpload[i+1:]...)
+			Logger.Debug("File taken from the queue", attrFile, file)
+			return file
+		}
+	}
+	return ""
+}
+
 // Len returns the length of the queue
 func (q *Queue) Len() int {
 	q.Lock()
 	defer q.Unlock()
 	return len(q.filesToUpload)
 }
+
+// Files returns a copy of the files in the queue, in the upload order
+func (q *Queue) Files() []string {
+	q.Lock()
+	defer q.Unlock()
+	return append([]string{}, q.filesToUpload...)
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestQueueNextWhere(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     []string
+		match     func(filename string) bool
+		want      string
+		remaining []string
+	}{
+		{
+			name:      "first file matches",
+			files:     []string{"a", "b", "c"},
+			match:     func(string) bool { return true },
+			want:      "a",
+			remaining: []string{"b", "c"},
+		},
+		{
+			name:      "skips files which don't match",
+			files:     []string{"security-1", "default-1", "security-2", "default-2"},
+			match:     func(filename string) bool { return strings.HasPrefix(filename, "default") },
+			want:      "default-1",
+			remaining: []string{"security-1", "security-2", "default-2"},
+		},
+		{
+			name:      "no file matches",
+			files:     []string{"a", "b"},
+			match:     func(string) bool { return false },
+			want:      "",
+			remaining: []string{"a", "b"},
+		},
+		{
+			name:      "empty queue",
+			match:     func(string) bool { return true },
+			want:      "",
+			remaining: []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := &Queue{}
+			for _, file := range test.files {
+				q.AddFile(file)
+			}
+			if got := q.NextWhere(test.match); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if got := q.Files(); !slices.Equal(got, test.remaining) {
+				t.Errorf("queue is %q, want %q", got, test.remaining)
+			}
+		})
+	}
+}
+
+func TestQueueReturnFile(t *testing.T) {
+	q := &Queue{}
+	q.AddFile("a")
+	q.AddFile("b")
+	file := q.Next()
+	q.ReturnFile(file)
+	q.ReturnFile("b") // Already queued
+	if got := q.Files(); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("queue is %q, want [a b]", got)
+	}
+}
@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// receiverCacheFilename is the file where the resolved receiver URL is cached
+const receiverCacheFilename = "jsumo-receiver"
+
+// provisionMinBackoff and provisionMaxBackoff limit the interval between attempts
+// to provision the receiver URL in the background
+const provisionMinBackoff = 5 * time.Second
+const provisionMaxBackoff = 5 * time.Minute
+
+// reresolveInterval is the minimum interval between attempts to re-resolve the primary receiver URL
+const reresolveInterval = 1 * time.Minute
+
+// Receiver is a receiver URL together with its health state
+type Receiver struct {
+	URL      string
+	failures int  // Consecutive failures
+	healthy  bool // False once failures reached the failover threshold
+}
+
+// ReceiverPool is an ordered list of receivers. The first receiver is the primary,
+// the rest are secondaries which are used when the primary keeps failing. While
+// a secondary is active, the receivers before it are probed in the background and
+// the pool fails back to them as soon as they recover
+type ReceiverPool struct {
+	sync.Mutex
+	receivers []*Receiver
+	active    int // Index of the receiver which is currently used
+	threshold int // Number of consecutive failures before switching to the next receiver
+
+	// Resolvable is true if the primary receiver URL was provisioned using SumoLogic
+	// API and can be resolved again when it becomes invalid
+	Resolvable  bool
+	resolving   bool
+	lastResolve time.Time
+}
+
+// Current returns the URL of the active receiver
+func (p *ReceiverPool) Current() string {
+	p.Lock()
+	defer p.Unlock()
+	if len(p.receivers) == 0 {
+		return ""
+	}
+	return p.receivers[p.active].URL
+}
+
+// ReportSuccess resets the failure counter of the receiver
+func (p *ReceiverPool) ReportSuccess(url string) {
+	p.Lock()
+	defer p.Unlock()
+	for _, r := range p.receivers {
+		if r.URL == url {
+			r.failures = 0
+			r.healthy = true
+		}
+	}
+}
+
+// ReportFailure registers a failed upload to the receiver. When the active receiver
+// reaches the failover threshold, the pool switches to the next receiver
+func (p *ReceiverPool) ReportFailure(url string) {
+	p.Lock()
+	defer p.Unlock()
+	if len(p.receivers) == 0 {
+		return
+	}
+	for _, r := range p.receivers {
+		if r.URL == url {
+			r.failures++
+			if r.failures >= p.threshold {
+				r.healthy = false
+			}
+		}
+	}
+	current := p.receivers[p.active]
+	if current.URL != url || current.healthy || len(p.receivers) < 2 {
+		return
+	}
+	p.switchTo(p.nextHealthy(), "failover")
+}
+
+// nextHealthy returns the index of the first healthy receiver after the active one.
+// If all receivers are unhealthy, the next receiver with a known URL is returned
+func (p *ReceiverPool) nextHealthy() int {
+	for i := 1; i < len(p.receivers); i++ {
+		idx := (p.active + i) % len(p.receivers)
+		if p.receivers[idx].healthy {
+			return idx
+		}
+	}
+	for i := 1; i < len(p.receivers); i++ {
+		idx := (p.active + i) % len(p.receivers)
+		if p.receivers[idx].URL != "" {
+			return idx
+		}
+	}
+	return p.active
+}
+
+// switchTo makes the receiver with the given index active. Must be called with the lock held
+func (p *ReceiverPool) switchTo(idx int, reason string) {
+	if idx == p.active {
+		return
+	}
+	Logger.Warn("Switching receiver",
+		"reason", reason,
+		"from", p.active,
+		"to", idx,
+		attrReceiver, redactReceiverURL(p.receivers[idx].URL),
+	)
+	p.active = idx
+	metricReceiverSwitches.WithLabelValues(reason).Inc()
+	metricActiveReceiver.Set(float64(idx))
+}
+
+// probe checks all receivers with higher priority than the active one and fails
+// back to the first one which responds successfully
+func (p *ReceiverPool) probe(ctx context.Context) {
+	p.Lock()
+	candidates := []string{}
+	for _, r := range p.receivers[:p.active] {
+		candidates = append(candidates, r.URL)
+	}
+	p.Unlock()
+
+	for idx, url := range candidates {
+		if url == "" {
+			continue
+		}
+		Logger.Debug("Probing receiver", "index", idx, attrReceiver, redactReceiverURL(url))
+		err := probeReceiver(ctx, url)
+		if err != nil {
+			Logger.Debug("Receiver is still unavailable", "index", idx, errAttr(err))
+			continue
+		}
+		p.Lock()
+		// Make sure that the pool wasn't changed while probing
+		if idx < p.active && p.receivers[idx].URL == url {
+			p.receivers[idx].failures = 0
+			p.receivers[idx].healthy = true
+			p.switchTo(idx, "failback")
+		}
+		p.Unlock()
+		return
+	}
+}
+
+// SetPrimary replaces the URL of the primary receiver. The files which are waiting
+// in the queue are uploaded to the new URL
+func (p *ReceiverPool) SetPrimary(url string) {
+	p.Lock()
+	defer p.Unlock()
+	if len(p.receivers) == 0 {
+		p.receivers = append(p.receivers, &Receiver{URL: url, healthy: true})
+		return
+	}
+	primary := p.receivers[0]
+	if primary.URL == url {
+		return
+	}
+	if primary.URL == "" {
+		Logger.Info("Receiver URL resolved. Ready to forward journalctl logs", attrReceiver, redactReceiverURL(url))
+	} else {
+		Logger.Warn("Primary receiver changed", "from", redactReceiverURL(primary.URL), attrReceiver, redactReceiverURL(url))
+	}
+	primary.URL = url
+	primary.failures = 0
+	primary.healthy = true
+	metricReceiverURLChanges.Inc()
+	p.switchTo(0, "resolved")
+}
+
+// ReresolvePrimary resolves the primary receiver URL again using SumoLogic API in the
+// background. It is used when the receiver rejects uploads because its URL was rotated
+// or the source was deleted. Attempts are limited to one per reresolveInterval
+func (p *ReceiverPool) ReresolvePrimary(ctx context.Context, rejectedURL string) {
+	p.Lock()
+	if len(p.receivers) == 0 || p.receivers[0].URL != rejectedURL {
+		p.Unlock()
+		return
+	}
+	if !p.Resolvable || p.resolving || time.Since(p.lastResolve) < reresolveInterval {
+		p.Unlock()
+		return
+	}
+	p.resolving = true
+	p.lastResolve = time.Now()
+	p.Unlock()
+
+	go func() {
+		defer func() {
+			p.Lock()
+			p.resolving = false
+			p.Unlock()
+		}()
+		Logger.Warn("Receiver URL rejected uploads, resolving it again...")
+		url, err := resolveReceiverURL(ctx)
+		if err != nil {
+			Logger.Error("Unable to resolve receiver URL", errAttr(err))
+			return
+		}
+		p.SetPrimary(url)
+	}()
+}
+
+// ProvisionPrimary resolves the primary receiver URL using SumoLogic API in the
+// background. Failed attempts are retried with exponential backoff until the URL
+// is resolved or the context is cancelled
+func (p *ReceiverPool) ProvisionPrimary(ctx context.Context) {
+	p.Lock()
+	p.resolving = true
+	p.lastResolve = time.Now()
+	p.Unlock()
+
+	go func() {
+		defer func() {
+			p.Lock()
+			p.resolving = false
+			p.Unlock()
+		}()
+		// The first attempt may take longer than the default start timeout of systemd
+		Systemd.Provisioning(0)
+		backoff := provisionMinBackoff
+		for {
+			url, err := resolveReceiverURL(ctx)
+			if err == nil {
+				p.SetPrimary(url)
+				Systemd.Ready()
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			Logger.Error("Unable to resolve receiver URL, retrying", "in", backoff, errAttr(err))
+			Systemd.Provisioning(backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, provisionMaxBackoff)
+		}
+	}()
+}
+
+// resolveReceiverURL resolves the receiver URL using SumoLogic API and caches it
+func resolveReceiverURL(ctx context.Context) (string, error) {
+	url, err := GetReceiverURL(ctx)
+	if err != nil {
+		return "", err
+	}
+	err = cacheReceiverURL(url)
+	if err != nil {
+		Logger.Error("Unable to cache receiver URL", errAttr(err))
+	}
+	return url, nil
+}
+
+// readCachedReceiverURL returns the cached receiver URL or an empty string if
+// it wasn't cached yet
+func readCachedReceiverURL() (string, error) {
+	stateDir, err := getStateDir()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path.Join(stateDir, receiverCacheFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// cacheReceiverURL stores the receiver URL in the working directory. The URL
+// contains a secret token, so the file is readable only by the owner
+func cacheReceiverURL(url string) error {
+	stateDir, err := getStateDir()
+	if err != nil {
+		return err
+	}
+	filename := path.Join(stateDir, receiverCacheFilename)
+	tmpFilename := filename + ".tmp"
+	err = os.WriteFile(tmpFilename, []byte(url), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFilename, filename)
+}
+
+// StartProbing probes receivers with higher priority than the active one every interval
+// until the context is cancelled
+func (p *ReceiverPool) StartProbing(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.probe(ctx)
+			}
+		}
+	}()
+}
+
+// NewReceiverPool creates a new receiver pool. The first URL is the primary receiver,
+// it can be empty if it isn't resolved yet
+func NewReceiverPool(urls []string, threshold int) *ReceiverPool {
+	if threshold < 1 {
+		threshold = 1
+	}
+	pool := &ReceiverPool{threshold: threshold}
+	for _, url := range urls {
+		// URL of the primary receiver is empty until it is resolved
+		pool.receivers = append(pool.receivers, &Receiver{URL: url, healthy: url != ""})
+	}
+	// Start with the first receiver with a known URL
+	for idx, r := range pool.receivers {
+		if r.URL != "" {
+			pool.active = idx
+			break
+		}
+	}
+	metricActiveReceiver.Set(float64(pool.active))
+	return pool
+}
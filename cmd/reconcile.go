@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+)
+
+// Drift is a difference between the desired and the actual value of a property
+// of a collector or a source in SumoLogic
+type Drift struct {
+	Property string
+	Actual   interface{}
+	Desired  interface{}
+}
+
+func (d Drift) String() string {
+	actual, _ := json.Marshal(d.Actual)
+	desired, _ := json.Marshal(d.Desired)
+	return fmt.Sprintf("~ %s: %s -> %s", d.Property, actual, desired)
+}
+
+// desiredCollectorProperties returns the properties of the collector managed by jsumo
+// Ref: https://help.sumologic.com/docs/api/collector-management/collector-api-methods-examples/#response-fields
+func desiredCollectorProperties(names SumoNames) map[string]interface{} {
+	properties := map[string]interface{}{
+		"name":        names.Collector,
+		"description": FlagCollectorDescription,
+	}
+	if FlagCollectorCategory != "" {
+		properties["category"] = FlagCollectorCategory
+	}
+	if FlagCollectorTimezone != "" {
+		properties["timeZone"] = FlagCollectorTimezone
+	}
+	if len(FlagCollectorFields) > 0 {
+		properties["fields"] = FlagCollectorFields
+	}
+	return properties
+}
+
+// desiredSourceProperties returns the properties of the HTTP source managed by jsumo
+// Ref: https://help.sumologic.com/docs/send-data/use-json-configure-sources/#common-parameters-for-log-source-types
+func desiredSourceProperties(names SumoNames) map[string]interface{} {
+	properties := map[string]interface{}{
+		"name":                       names.Source,
+		"description":                FlagSourceDescription,
+		"category":                   names.Category,
+		"hostName":                   names.HostName,
+		"automaticDateParsing":       FlagSourceAutoDateParsing,
+		"multilineProcessingEnabled": FlagSourceMultiline,
+	}
+	if FlagSourceMultiline {
+		properties["useAutolineMatching"] = FlagSourceMultilineRegex == ""
+		if FlagSourceMultilineRegex != "" {
+			properties["manualPrefixRegexp"] = FlagSourceMultilineRegex
+		}
+	}
+	if FlagSourceTimezone != "" {
+		properties["timeZone"] = FlagSourceTimezone
+		properties["forceTimeZone"] = true
+	}
+	if len(FlagSourceFields) > 0 {
+		properties["fields"] = FlagSourceFields
+	}
+	return properties
+}
+
+// collectorPropertySettings and sourcePropertySettings are the settings which set the
+// properties of the collector and the source. Existing objects are reconciled only for
+// the settings given on the command line or in the configuration file, so defaults don't
+// undo changes made in SumoLogic. Unlisted properties, e.g. the names, are always reconciled
+var collectorPropertySettings = map[string][]string{
+	"description": {"collector-description"},
+	"category":    {"collector-category"},
+	"timeZone":    {"collector-timezone"},
+	"fields":      {"collector-fields"},
+}
+var sourcePropertySettings = map[string][]string{
+	"description":                {"source-description"},
+	"category":                   {"source-category"},
+	"hostName":                   {"source-host"},
+	"automaticDateParsing":       {"source-auto-date-parsing"},
+	"multilineProcessingEnabled": {"source-multiline"},
+	"useAutolineMatching":        {"source-multiline", "source-multiline-regex"},
+	"manualPrefixRegexp":         {"source-multiline-regex"},
+	"timeZone":                   {"source-timezone"},
+	"forceTimeZone":              {"source-timezone"},
+	"fields":                     {"source-fields"},
+}
+
+// managedProperties returns the desired properties which are reconciled: the ones
+// without settings and the ones whose settings were set explicitly
+func managedProperties(desired map[string]interface{}, settings map[string][]string) map[string]interface{} {
+	managed := map[string]interface{}{}
+	for key, value := range desired {
+		names, ok := settings[key]
+		if !ok || slices.ContainsFunc(names, settingChanged) {
+			managed[key] = value
+		}
+	}
+	return managed
+}
+
+// findDrift compares the desired properties with the actual ones
+func findDrift(actual, desired map[string]interface{}) []Drift {
+	keys := []string{}
+	for key := range desired {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	drift := []Drift{}
+	for _, key := range keys {
+		if !jsonEqual(actual[key], desired[key]) {
+			drift = append(drift, Drift{Property: key, Actual: actual[key], Desired: desired[key]})
+		}
+	}
+	return drift
+}
+
+// jsonEqual returns true if both values are equal once encoded as JSON. Missing
+// actual value is equal to the zero value of the desired one
+func jsonEqual(actual, desired interface{}) bool {
+	if actual == nil {
+		return desired == nil || reflect.ValueOf(desired).IsZero()
+	}
+	actualBytes, err := json.Marshal(actual)
+	if err != nil {
+		return false
+	}
+	// Round trip the desired value to get the same representation as the actual one
+	desiredBytes, err := json.Marshal(desired)
+	if err != nil {
+		return false
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(desiredBytes, &normalized); err != nil {
+		return false
+	}
+	desiredBytes, err = json.Marshal(normalized)
+	if err != nil {
+		return false
+	}
+	return string(actualBytes) == string(desiredBytes)
+}
+
+// reconcileSumoObject brings the object at the given endpoint to the desired state. The
+// object is fetched with its ETag and updated using PUT with If-Match, so concurrent
+// modifications are not overwritten. When dryRun is true, only the drift is returned
+func reconcileSumoObject(ctx context.Context, endpoint, kind string, desired map[string]interface{}, dryRun bool) ([]Drift, error) {
+	respBodyBytes, headers, err := SumoAPI.Do(ctx, "GET", endpoint, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response map[string]map[string]interface{}
+	if err := json.Unmarshal(respBodyBytes, &response); err != nil {
+		return nil, err
+	}
+	actual, ok := response[kind]
+	if !ok {
+		return nil, fmt.Errorf("unexpected response from %s, %s is missing", endpoint, kind)
+	}
+
+	drift := findDrift(actual, desired)
+	if len(drift) == 0 || dryRun {
+		return drift, nil
+	}
+
+	for _, d := range drift {
+		actual[d.Property] = d.Desired
+	}
+	etag := headers.Get("ETag")
+	if etag == "" {
+		return nil, fmt.Errorf("no ETag returned for %s", endpoint)
+	}
+	Logger.Warn("Updating "+kind, "name", actual["name"], "changes", len(drift))
+	_, _, err = SumoAPI.Do(ctx, "PUT", endpoint, map[string]interface{}{kind: actual}, map[string]string{"If-Match": etag})
+	if err != nil {
+		return nil, err
+	}
+	return drift, nil
+}
+
+// reconcileSumoCollector brings the collector to the desired state
+func reconcileSumoCollector(ctx context.Context, collectorID int, names SumoNames, dryRun bool) ([]Drift, error) {
+	Logger.Debug("Reconciling collector", "id", collectorID)
+	return reconcileSumoObject(ctx, fmt.Sprintf("/collectors/%d", collectorID), "collector", managedProperties(desiredCollectorProperties(names), collectorPropertySettings), dryRun)
+}
+
+// reconcileSumoHTTPSource brings the HTTP source to the desired state
+func reconcileSumoHTTPSource(ctx context.Context, collectorID, sourceID int, names SumoNames, dryRun bool) ([]Drift, error) {
+	Logger.Debug("Reconciling source", "id", sourceID)
+	return reconcileSumoObject(ctx, fmt.Sprintf("/collectors/%d/sources/%d", collectorID, sourceID), "source", managedProperties(desiredSourceProperties(names), sourcePropertySettings), dryRun)
+}
+
+// PlanSumo prints the changes which would be made to the collector and the source
+// in SumoLogic without making them
+func PlanSumo(ctx context.Context) error {
+	names, err := renderSumoNames()
+	if err != nil {
+		return err
+	}
+
+	collectorID, err := getSumoCollectorIDFromName(ctx, names.Collector)
+	if errors.Is(err, ErrNotFound) {
+		fmt.Printf("collector %s:\n  + will be created\n", names.Collector)
+		fmt.Printf("source %s:\n  + will be created\n", names.Source)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	drift, err := reconcileSumoCollector(ctx, collectorID, names, true)
+	if err != nil {
+		return err
+	}
+	printDrift(fmt.Sprintf("collector %s (ID %d)", names.Collector, collectorID), drift)
+
+	source, err := getSumoHTTPSourceFromName(ctx, collectorID, names.Source)
+	if errors.Is(err, ErrNotFound) {
+		fmt.Printf("source %s:\n  + will be created\n", names.Source)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	drift, err = reconcileSumoHTTPSource(ctx, collectorID, source.ID, names, true)
+	if err != nil {
+		return err
+	}
+	printDrift(fmt.Sprintf("source %s (ID %d)", names.Source, source.ID), drift)
+	return nil
+}
+
+// printDrift prints the drift of the object in a human readable form
+func printDrift(object string, drift []Drift) {
+	fmt.Printf("%s:\n", object)
+	if len(drift) == 0 {
+		fmt.Println("  no changes")
+		return
+	}
+	for _, d := range drift {
+		fmt.Printf("  %s\n", d)
+	}
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestFindDrift(t *testing.T) {
+	tests := []struct {
+		name    string
+		actual  map[string]interface{}
+		desired map[string]interface{}
+		want    []string
+	}{
+		{
+			name:    "no drift",
+			actual:  map[string]interface{}{"name": "web", "multilineProcessingEnabled": true, "extra": 1},
+			desired: map[string]interface{}{"name": "web", "multilineProcessingEnabled": true},
+			want:    []string{},
+		},
+		{
+			name:    "changed values, sorted by property",
+			actual:  map[string]interface{}{"name": "web", "description": "old", "automaticDateParsing": false},
+			desired: map[string]interface{}{"name": "web", "description": "new", "automaticDateParsing": true},
+			want:    []string{`~ automaticDateParsing: false -> true`, `~ description: "old" -> "new"`},
+		},
+		{
+			name:    "missing value equals zero value",
+			actual:  map[string]interface{}{},
+			desired: map[string]interface{}{"forceTimeZone": false, "timeZone": "Etc/UTC"},
+			want:    []string{`~ timeZone: null -> "Etc/UTC"`},
+		},
+		{
+			name:    "fields compared as JSON",
+			actual:  map[string]interface{}{"fields": map[string]interface{}{"env": "prod", "team": "ops"}},
+			desired: map[string]interface{}{"fields": map[string]string{"team": "ops", "env": "prod"}},
+			want:    []string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := []string{}
+			for _, d := range findDrift(test.actual, test.desired) {
+				got = append(got, d.String())
+			}
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestManagedProperties(t *testing.T) {
+	desired := map[string]interface{}{
+		"name":                 "web",
+		"description":          "Created by jsumo",
+		"category":             "web",
+		"hostName":             "web",
+		"automaticDateParsing": true,
+		"timeZone":             "Etc/UTC",
+		"forceTimeZone":        true,
+	}
+	tests := []struct {
+		name     string
+		explicit []string
+		want     []string
+	}{
+		{"defaults only", nil, []string{"name"}},
+		{"explicit settings", []string{"source-timezone", "source-category"}, []string{"category", "forceTimeZone", "name", "timeZone"}},
+		{"unrelated settings", []string{"collector-description"}, []string{"name"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previous := explicitSettings
+			t.Cleanup(func() { explicitSettings = previous })
+			explicitSettings = map[string]bool{}
+			for _, name := range test.explicit {
+				explicitSettings[name] = true
+			}
+			got := slices.Sorted(maps.Keys(managedProperties(desired, sourcePropertySettings)))
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReconcileSumoObject(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dry run %v", dryRun), func(t *testing.T) {
+			var updated map[string]map[string]interface{}
+			ifMatch := ""
+			newTestSumoAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.Method {
+				case http.MethodGet:
+					w.Header().Set("ETag", `"v1"`)
+					fmt.Fprint(w, `{"source": {"id": 2, "name": "web", "description": "edited in UI", "timeZone": "Etc/GMT"}}`)
+				case http.MethodPut:
+					ifMatch = r.Header.Get("If-Match")
+					json.NewDecoder(r.Body).Decode(&updated)
+					fmt.Fprint(w, `{}`)
+				}
+			}))
+
+			desired := map[string]interface{}{"name": "web", "timeZone": "Etc/UTC"}
+			drift, err := reconcileSumoObject(context.Background(), "/collectors/1/sources/2", "source", desired, dryRun)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(drift) != 1 || drift[0].Property != "timeZone" {
+				t.Errorf("drift: %v", drift)
+			}
+			if dryRun {
+				if updated != nil {
+					t.Error("object updated in dry run")
+				}
+				return
+			}
+			if ifMatch != `"v1"` {
+				t.Errorf("If-Match is %q", ifMatch)
+			}
+			// Properties which aren't managed are sent back unchanged
+			source := updated["source"]
+			if source["timeZone"] != "Etc/UTC" || source["description"] != "edited in UI" {
+				t.Errorf("updated source: %v", source)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReplayUpload(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		attempts    int
+		wantErr     bool
+		wantUploads int32
+		wantQueue   int
+	}{
+		{name: "uploaded", status: http.StatusOK, attempts: 3, wantUploads: 2},
+		{name: "failing receiver", status: http.StatusServiceUnavailable, attempts: 3, wantErr: true, wantUploads: 3, wantQueue: 2},
+		{name: "rejecting receiver", status: http.StatusGone, attempts: 1, wantErr: true, wantUploads: 1, wantQueue: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			receiver := newTestReceiver(t, test.status)
+			// The receivers of jsumo could be resolved again, the replay must not use them
+			var apiRequests atomic.Int32
+			newTestSumoAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				apiRequests.Add(1)
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			previousReceivers := Receivers
+			t.Cleanup(func() { Receivers = previousReceivers })
+			Receivers = NewReceiverPool([]string{"https://collectors/receiver/v1/http/jsumo"}, 1)
+			Receivers.Resolvable = true
+			setDestinations(nil)
+
+			metadata, err := NewMetadataRenderer("", "", "", nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader := &JournalReader{workingDir: t.TempDir(), counter: initialCounter, since: time.Now(), metadata: metadata}
+			processTestLogs(t, reader, []string{journalLine("c1", "sshd.service", "Accepted publickey")})
+			processTestLogs(t, reader, []string{journalLine("c2", "nginx.service", "GET /")})
+			UploadQueue = Queue{}
+			files, err := batchFilesIn(reader.workingDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range files {
+				UploadQueue.AddFile(file)
+			}
+
+			replay := &Replay{reader: reader, receiver: receiver.URL, attempts: test.attempts, retryInterval: time.Millisecond}
+			err = replay.upload(context.Background())
+			if (err != nil) != test.wantErr {
+				t.Fatalf("upload() error = %v, want error %v", err, test.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "files are left in the queue") {
+				t.Errorf("error %q doesn't tell that the files are kept", err)
+			}
+			if got := receiver.requests.Load(); got != test.wantUploads {
+				t.Errorf("%d uploads, want %d", got, test.wantUploads)
+			}
+			if got := UploadQueue.Len(); got != test.wantQueue {
+				t.Errorf("%d files left in the queue, want %d", got, test.wantQueue)
+			}
+			if !test.wantErr && replay.state.Batches != 2 {
+				t.Errorf("%d batches replayed, want 2", replay.state.Batches)
+			}
+			if got := Receivers.Current(); got != "https://collectors/receiver/v1/http/jsumo" {
+				t.Errorf("receiver of jsumo changed to %q", got)
+			}
+			// ReresolvePrimary runs in the background
+			time.Sleep(10 * time.Millisecond)
+			if got := apiRequests.Load(); got != 0 {
+				t.Errorf("%d requests to SumoLogic API", got)
+			}
+		})
+	}
+}
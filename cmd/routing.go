@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// defaultDestination is the name of the destination of logs which don't match any
+// route, it is the primary receiver with its failover receivers
+const defaultDestination = "default"
+
+// destinationCredentialPrefix is the prefix of the credentials with the receiver URLs
+// of named destinations, e.g. SUMO_RECEIVER_URL_SECURITY
+const destinationCredentialPrefix = sumoReceiverURLCredential + "_"
+
+// Route sends the journal entries which match all its conditions to a destination,
+// optionally with a different category. Routes are defined as semicolon separated
+// key=value pairs, e.g. "unit=sshd.service;destination=security;category=security/{{unit}}"
+type Route struct {
+	spec        string
+	unit        string         // Glob pattern of the systemd unit
+	identifier  string         // Glob pattern of the syslog identifier
+	priority    int            // Entries with this or a more severe priority match, -1 matches all
+	message     *regexp.Regexp // Regular expression of the message
+	destination string
+	category    *template.Template
+}
+
+// Matches returns true if the entry matches all conditions of the route. A route
+// without conditions matches all entries
+func (r *Route) Matches(entry JournalEntry) bool {
+	if r.unit != "" {
+		if ok, _ := path.Match(r.unit, entry.Unit()); !ok {
+			return false
+		}
+	}
+	if r.identifier != "" {
+		if ok, _ := path.Match(r.identifier, entry.Identifier()); !ok {
+			return false
+		}
+	}
+	if r.priority >= 0 && entry.Priority() > r.priority {
+		return false
+	}
+	if r.message != nil && !r.message.MatchString(entry["MESSAGE"]) {
+		return false
+	}
+	return true
+}
+
+// parsePriority parses the syslog priority as a name (err) or a number (3)
+func parsePriority(value string) (int, error) {
+	for i, name := range priorityNames {
+		if value == name {
+			return i, nil
+		}
+	}
+	priority, err := strconv.Atoi(value)
+	if err != nil || priority < 0 || priority >= len(priorityNames) {
+		return 0, fmt.Errorf("invalid priority %q, expected 0-7 or one of %s", value, strings.Join(priorityNames, ", "))
+	}
+	return priority, nil
+}
+
+// parseRoute parses the route definition. The category template is parsed with the
+// given function, so it has access to the fields of the entry
+func parseRoute(spec string, parseTemplate func(what, text string) (*template.Template, error)) (*Route, error) {
+	route := &Route{spec: spec, priority: -1, destination: defaultDestination}
+	for _, pair := range strings.Split(spec, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid route %q: expected key=value, got %q", spec, pair)
+		}
+		var err error
+		switch key {
+		case "unit":
+			_, err = path.Match(value, "")
+			route.unit = value
+		case "identifier":
+			_, err = path.Match(value, "")
+			route.identifier = value
+		case "priority":
+			route.priority, err = parsePriority(value)
+		case "message":
+			route.message, err = regexp.Compile(value)
+		case "destination":
+			route.destination = value
+		case "category":
+			route.category, err = parseTemplate("route category", value)
+		default:
+			err = fmt.Errorf("unknown key %q, expected unit, identifier, priority, message, destination or category", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %q: %w", spec, err)
+		}
+	}
+	if route.destination == "" {
+		return nil, fmt.Errorf("invalid route %q: destination is empty", spec)
+	}
+	return route, nil
+}
+
+// maxDeferredBatches limits the number of batch files of failing destinations which are
+// kept while logs are read for other destinations
+const maxDeferredBatches = 1000
+
+// DestinationStates tracks the destinations whose last upload failed. Their batch files
+// are skipped while files of other destinations are waiting, so one unavailable
+// destination doesn't hold back the others
+type DestinationStates struct {
+	sync.Mutex
+	failing map[string]bool
+}
+
+// SetFailing records the result of the last upload to the destination
+func (s *DestinationStates) SetFailing(destination string, failing bool) {
+	s.Lock()
+	defer s.Unlock()
+	if s.failing == nil {
+		s.failing = map[string]bool{}
+	}
+	s.failing[destination] = failing
+}
+
+// IsFailing returns true if the last upload to the destination failed
+func (s *DestinationStates) IsFailing(destination string) bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.failing[destination]
+}
+
+// FailingDestinations are the states of the destinations of this process
+var FailingDestinations = &DestinationStates{}
+
+// batchDestination returns the name of the destination of the batch file
+func batchDestination(filename string) string {
+	metadata, _ := readBatchMetadata(filename)
+	return metadata.DestinationName()
+}
+
+// routedDestinations returns true if named destinations are configured besides the
+// default one
+func routedDestinations() bool {
+	destinationsLock.RLock()
+	defer destinationsLock.RUnlock()
+	return len(Destinations) > 0
+}
+
+// destinationsLock guards Destinations, which are replaced when the configuration is reloaded
+var destinationsLock sync.RWMutex
+
+// setDestinations replaces the receiver URLs of the named destinations
+func setDestinations(destinations map[string]string) {
+	destinationsLock.Lock()
+	defer destinationsLock.Unlock()
+	Destinations = destinations
+	for name, url := range destinations {
+		Logger.Info("Destination configured", attrDestination, name, attrReceiver, redactReceiverURL(url))
+	}
+}
+
+// resolveDestinations returns the receiver URLs of the named destinations used by the
+// routes. The URLs are taken from urls (--destination) or read from SUMO_RECEIVER_URL_<NAME>
+// credentials, the default destination is not included
+func resolveDestinations(names []string, urls map[string]string) (map[string]string, error) {
+	destinations := map[string]string{}
+	for _, name := range names {
+		if name == defaultDestination {
+			continue
+		}
+		if url, ok := urls[name]; ok && url != "" {
+			destinations[name] = url
+			continue
+		}
+		credential := destinationCredentialPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		url, err := Credentials.Get(credential)
+		if err != nil {
+			return nil, fmt.Errorf("receiver URL of destination %s is not set, use --destination %s=<url> or %s credential: %w", name, name, credential, err)
+		}
+		destinations[name] = url
+	}
+	return destinations, nil
+}
+
+// destinationNames returns the sorted names of the destinations used by the routes
+func destinationNames(routes []*Route) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, route := range routes {
+		if !seen[route.destination] {
+			seen[route.destination] = true
+			names = append(names, route.destination)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// batchReceiverURL returns the receiver URL of the batch file destination. The second
+// value is true if it is the default destination, which supports failover
+func batchReceiverURL(filename string) (string, bool) {
+	if url, ok := namedReceiverURL(filename); ok {
+		return url, false
+	}
+	return Receivers.Current(), true
+}
+
+// namedReceiverURL returns the receiver URL of the named destination of the batch file.
+// The second value is false if the batch file belongs to the default destination
+func namedReceiverURL(filename string) (string, bool) {
+	metadata, err := readBatchMetadata(filename)
+	if err != nil {
+		Logger.Error("Unable to read metadata of the batch file", attrFile, filename, errAttr(err))
+	}
+	if metadata.Destination == "" || metadata.Destination == defaultDestination {
+		return "", false
+	}
+	destinationsLock.RLock()
+	url, ok := Destinations[metadata.Destination]
+	destinationsLock.RUnlock()
+	if !ok {
+		// The routes were changed since the batch file was created
+		Logger.Error("Destination of the batch file is not configured, using the default destination", attrFile, filename, attrDestination, metadata.Destination)
+		return "", false
+	}
+	return url, true
+}
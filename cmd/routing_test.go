@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestParseRoute(t *testing.T) {
+	renderer := &MetadataRenderer{}
+	tests := []struct {
+		spec        string
+		wantErr     bool
+		destination string
+		priority    int
+		category    bool
+	}{
+		{spec: "unit=sshd.service;destination=security", destination: "security", priority: -1},
+		{spec: " unit=sshd.service ; destination=security ; ", destination: "security", priority: -1},
+		{spec: "priority=err", destination: defaultDestination, priority: 3},
+		{spec: "priority=5;destination=audit", destination: "audit", priority: 5},
+		{spec: "identifier=kernel;category=kernel/{{hostname}}", destination: defaultDestination, priority: -1, category: true},
+		{spec: "message=^panic:;destination=alerts", destination: "alerts", priority: -1},
+		{spec: "", destination: defaultDestination, priority: -1},
+		{spec: "unit", wantErr: true},
+		{spec: "unit=[", wantErr: true},
+		{spec: "priority=8", wantErr: true},
+		{spec: "priority=loud", wantErr: true},
+		{spec: "message=(", wantErr: true},
+		{spec: "destination=", wantErr: true},
+		{spec: "category={{unit", wantErr: true},
+		{spec: "host=web", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			route, err := parseRoute(test.spec, renderer.parse)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if route.destination != test.destination || route.priority != test.priority || (route.category != nil) != test.category {
+				t.Errorf("got destination %q, priority %d, category %t", route.destination, route.priority, route.category != nil)
+			}
+		})
+	}
+}
+
+func TestRouteMatches(t *testing.T) {
+	entry := JournalEntry{"_SYSTEMD_UNIT": "sshd.service", "SYSLOG_IDENTIFIER": "sshd", "PRIORITY": "4", "MESSAGE": "Failed password for root"}
+	tests := []struct {
+		spec string
+		want bool
+	}{
+		{"", true},
+		{"unit=sshd.service", true},
+		{"unit=ssh*", true},
+		{"unit=nginx.service", false},
+		{"identifier=sshd", true},
+		{"identifier=cron", false},
+		{"priority=warning", true},
+		{"priority=err", false},
+		{"message=^Failed password", true},
+		{"message=^Accepted", false},
+		{"unit=sshd.service;priority=err", false},
+		{"unit=sshd.service;identifier=sshd;priority=debug;message=root", true},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			route, err := parseRoute(test.spec, (&MetadataRenderer{}).parse)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := route.Matches(entry); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMetadataRendererRoutes(t *testing.T) {
+	renderer, err := NewMetadataRenderer("prod/{{unit}}", "{{identifier}}", "", map[string]string{"level": "{{priority}}"}, []string{
+		"unit=sshd.service;destination=security;category=security/{{hostname}}",
+		"priority=err;destination=alerts",
+		"unit=ssh*;destination=never",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		entry JournalEntry
+		want  BatchMetadata
+	}{
+		{
+			name:  "first matching route wins",
+			entry: JournalEntry{"_SYSTEMD_UNIT": "sshd.service", "_HOSTNAME": "web", "SYSLOG_IDENTIFIER": "sshd", "PRIORITY": "3"},
+			want:  BatchMetadata{Destination: "security", Category: "security/web", Name: "sshd", Fields: map[string]string{"level": "err"}},
+		},
+		{
+			name:  "route without category keeps the default category",
+			entry: JournalEntry{"_SYSTEMD_UNIT": "nginx.service", "SYSLOG_IDENTIFIER": "nginx", "PRIORITY": "2"},
+			want:  BatchMetadata{Destination: "alerts", Category: "prod/nginx.service", Name: "nginx", Fields: map[string]string{"level": "crit"}},
+		},
+		{
+			name:  "no route matches",
+			entry: JournalEntry{"_SYSTEMD_UNIT": "cron.service", "_COMM": "cron"},
+			want:  BatchMetadata{Category: "prod/cron.service", Name: "cron", Fields: map[string]string{"level": "info"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := renderer.Render(test.entry)
+			if got.key() != test.want.key() {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+	if got := renderer.Destinations(); len(got) != 3 || got[0] != "alerts" || got[1] != "never" || got[2] != "security" {
+		t.Errorf("destinations are %q", got)
+	}
+}
+
+func TestResolveDestinations(t *testing.T) {
+	t.Setenv("SUMO_RECEIVER_URL_AUDIT_LOGS", "http://audit")
+	previous := Credentials
+	t.Cleanup(func() { Credentials = previous })
+	Credentials = NewCredentialChain("")
+
+	destinations, err := resolveDestinations([]string{defaultDestination, "audit-logs", "security"}, map[string]string{"security": "http://security"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(destinations) != 2 || destinations["audit-logs"] != "http://audit" || destinations["security"] != "http://security" {
+		t.Errorf("destinations are %v", destinations)
+	}
+	if _, err := resolveDestinations([]string{"missing"}, nil); err == nil {
+		t.Error("no error for a destination without receiver URL")
+	}
+}
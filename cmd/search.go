@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// searchPageSize is the number of messages requested per page from a search job
+const searchPageSize = 10000
+
+// searchPollInterval is the interval to check the status of a search job
+const searchPollInterval = 2 * time.Second
+
+// Search job states
+// Ref: https://help.sumologic.com/docs/api/search-job/#get-the-current-search-job-status
+const searchStateDone = "DONE GATHERING RESULTS"
+const searchStateCancelled = "CANCELLED"
+const searchStateForcePaused = "FORCE PAUSED"
+
+// createSearchJob creates a new search job and returns its ID
+func createSearchJob(ctx context.Context, query string, from, to time.Time, byReceiptTime bool) (string, error) {
+	Logger.Debug("Creating search job", "query", query)
+	request := SearchJobRequest{
+		Query:         query,
+		From:          from.UTC().Format("2006-01-02T15:04:05"),
+		To:            to.UTC().Format("2006-01-02T15:04:05"),
+		TimeZone:      "UTC",
+		ByReceiptTime: byReceiptTime,
+	}
+	var response SearchJobResponse
+	err := SumoAPI.DoJSON(ctx, "POST", "/search/jobs", request, &response)
+	if err != nil {
+		return "", err
+	}
+	if response.ID == "" {
+		return "", fmt.Errorf("search job ID is missing in the response")
+	}
+	return response.ID, nil
+}
+
+// getSearchJobStatus returns the status of the search job
+func getSearchJobStatus(ctx context.Context, jobID string) (SearchJobStatus, error) {
+	var status SearchJobStatus
+	err := SumoAPI.DoJSON(ctx, "GET", "/search/jobs/"+url.PathEscape(jobID), nil, &status)
+	return status, err
+}
+
+// getSearchJobMessages returns a page of messages found by the search job
+func getSearchJobMessages(ctx context.Context, jobID string, offset, limit int) ([]SearchMessage, error) {
+	var response SearchMessagesResponse
+	err := SumoAPI.DoJSON(ctx, "GET", fmt.Sprintf("/search/jobs/%s/messages?offset=%d&limit=%d", url.PathEscape(jobID), offset, limit), nil, &response)
+	return response.Messages, err
+}
+
+// deleteSearchJob deletes the search job, so it doesn't count towards the limit of
+// concurrent search jobs
+func deleteSearchJob(ctx context.Context, jobID string) error {
+	Logger.Debug("Deleting search job", "job", jobID)
+	return SumoAPI.DoJSON(ctx, "DELETE", "/search/jobs/"+url.PathEscape(jobID), nil, nil)
+}
+
+// waitForSearchJob polls the status of the search job until it has gathered all results
+func waitForSearchJob(ctx context.Context, jobID string) (SearchJobStatus, error) {
+	ticker := time.NewTicker(searchPollInterval)
+	defer ticker.Stop()
+	for {
+		status, err := getSearchJobStatus(ctx, jobID)
+		if err != nil {
+			return status, err
+		}
+		Logger.Debug("Search job status", "job", jobID, "state", status.State, "messages", status.MessageCount)
+		switch status.State {
+		case searchStateDone:
+			return status, nil
+		case searchStateCancelled, searchStateForcePaused:
+			return status, fmt.Errorf("search job %s stopped: %s %v", jobID, status.State, status.PendingErrors)
+		}
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunSearch runs the query in SumoLogic using the Search Job API and calls handle for
+// every found message, at most limit messages are returned (0 means no limit). The
+// search job is deleted when the search is complete
+// Ref: https://help.sumologic.com/docs/api/search-job/
+func RunSearch(ctx context.Context, query string, from, to time.Time, byReceiptTime bool, limit int, handle func(SearchMessage) error) error {
+	jobID, err := createSearchJob(ctx, query, from, to, byReceiptTime)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// The job must be deleted even if the search was interrupted
+		deleteCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := deleteSearchJob(deleteCtx, jobID); err != nil {
+			Logger.Error("Unable to delete search job", "job", jobID, errAttr(err))
+		}
+	}()
+
+	status, err := waitForSearchJob(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	total := status.MessageCount
+	if limit > 0 && limit < total {
+		total = limit
+	}
+
+	handled := 0
+	for handled < total {
+		messages, err := getSearchJobMessages(ctx, jobID, handled, min(searchPageSize, total-handled))
+		if err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			break
+		}
+		for _, message := range messages {
+			if handled >= total {
+				break
+			}
+			if err := handle(message); err != nil {
+				return err
+			}
+			handled++
+		}
+	}
+	return nil
+}
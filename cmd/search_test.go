@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// fakeSearchJobs is a search job of the SumoLogic API which found count messages
+type fakeSearchJobs struct {
+	sync.Mutex
+	state         string
+	count         int
+	available     int  // Messages which can be fetched, fewer than count if set
+	failMessages  bool // Requests of messages fail
+	pages         []string
+	deleted       bool
+	statusQueries int
+}
+
+func (f *fakeSearchJobs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/search/jobs":
+		fmt.Fprint(w, `{"id": "job1"}`)
+	case r.Method == http.MethodGet && r.URL.Path == "/search/jobs/job1":
+		f.statusQueries++
+		json.NewEncoder(w).Encode(SearchJobStatus{State: f.state, MessageCount: f.count, PendingErrors: []string{"boom"}})
+	case r.Method == http.MethodGet && r.URL.Path == "/search/jobs/job1/messages":
+		if f.failMessages {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		f.pages = append(f.pages, fmt.Sprintf("%d+%d", offset, limit))
+		available := f.count
+		if f.available > 0 {
+			available = f.available
+		}
+		response := SearchMessagesResponse{Messages: []SearchMessage{}}
+		for i := offset; i < min(offset+limit, available); i++ {
+			response.Messages = append(response.Messages, SearchMessage{Map: map[string]string{"_raw": strconv.Itoa(i)}})
+		}
+		json.NewEncoder(w).Encode(response)
+	case r.Method == http.MethodDelete && r.URL.Path == "/search/jobs/job1":
+		f.deleted = true
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRunSearchPaging(t *testing.T) {
+	tests := []struct {
+		name      string
+		count     int
+		available int
+		limit     int
+		wantPages string
+		want      int
+	}{
+		{name: "single page", count: 3, wantPages: "[0+3]", want: 3},
+		{name: "several pages", count: searchPageSize + 2000, wantPages: "[0+10000 10000+2000]", want: searchPageSize + 2000},
+		{name: "limit", count: searchPageSize + 2000, limit: searchPageSize + 5, wantPages: "[0+10000 10000+5]", want: searchPageSize + 5},
+		{name: "limit above the count", count: 7, limit: 100, wantPages: "[0+7]", want: 7},
+		{name: "fewer messages than counted", count: 10, available: 4, wantPages: "[0+10 4+6]", want: 4},
+		{name: "no messages", count: 0, wantPages: "[]", want: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &fakeSearchJobs{state: searchStateDone, count: test.count, available: test.available}
+			newTestSumoAPI(t, fake)
+
+			handled := 0
+			err := RunSearch(context.Background(), "error", time.Now().Add(-time.Hour), time.Now(), false, test.limit, func(message SearchMessage) error {
+				if message.Map["_raw"] != strconv.Itoa(handled) {
+					t.Fatalf("message %s handled as %d", message.Map["_raw"], handled)
+				}
+				handled++
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if handled != test.want {
+				t.Errorf("%d messages handled, want %d", handled, test.want)
+			}
+			if fmt.Sprint(fake.pages) != test.wantPages {
+				t.Errorf("pages %v, want %s", fake.pages, test.wantPages)
+			}
+			if !fake.deleted {
+				t.Error("search job wasn't deleted")
+			}
+		})
+	}
+}
+
+func TestRunSearchDeletesJobOnError(t *testing.T) {
+	errHandler := errors.New("handler failed")
+	tests := []struct {
+		name    string
+		fake    *fakeSearchJobs
+		handle  func(SearchMessage) error
+		wantErr error
+	}{
+		{
+			name:   "messages request fails",
+			fake:   &fakeSearchJobs{state: searchStateDone, count: 5, failMessages: true},
+			handle: func(SearchMessage) error { return nil },
+		},
+		{
+			name:    "handler fails",
+			fake:    &fakeSearchJobs{state: searchStateDone, count: 5},
+			handle:  func(SearchMessage) error { return errHandler },
+			wantErr: errHandler,
+		},
+		{
+			name:   "job cancelled",
+			fake:   &fakeSearchJobs{state: searchStateCancelled},
+			handle: func(SearchMessage) error { return nil },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newTestSumoAPI(t, test.fake)
+			err := RunSearch(context.Background(), "error", time.Now().Add(-time.Hour), time.Now(), false, 0, test.handle)
+			if err == nil || (test.wantErr != nil && !errors.Is(err, test.wantErr)) {
+				t.Errorf("error %v, want %v", err, test.wantErr)
+			}
+			if !test.fake.deleted {
+				t.Error("search job wasn't deleted")
+			}
+		})
+	}
+}
+
+func TestRunSearchDeletesJobWhenInterrupted(t *testing.T) {
+	fake := &fakeSearchJobs{state: "GATHERING RESULTS"}
+	newTestSumoAPI(t, fake)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := RunSearch(ctx, "error", time.Now().Add(-time.Hour), time.Now(), false, 0, func(SearchMessage) error { return nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v, want deadline exceeded", err)
+	}
+	fake.Lock()
+	defer fake.Unlock()
+	if !fake.deleted {
+		t.Error("search job wasn't deleted")
+	}
+}
+
+func TestParseSearchTime(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "", want: now},
+		{value: "now", want: now},
+		{value: "15m", want: now.Add(-15 * time.Minute)},
+		{value: "2025-01-01T10:30:00Z", want: time.Date(2025, 1, 1, 10, 30, 0, 0, time.UTC)},
+		{value: "yesterday", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := parseSearchTime(test.value, now)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error: %v", err)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckOutputFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		formats   []string // Annotated formats of the command, if set
+		value     string
+		wantError bool
+	}{
+		{name: "table", value: "table"},
+		{name: "json", value: "json"},
+		{name: "unknown", value: "yaml", wantError: true},
+		{name: "text of a table command", value: "text", wantError: true},
+		{name: "text of search", formats: []string{"text", "json"}, value: "text"},
+		{name: "table of search", formats: []string{"text", "json"}, value: "table", wantError: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			flags.StringP("output", "o", "", "")
+			if test.formats != nil {
+				flags.SetAnnotation("output", outputFormatsAnnotation, test.formats)
+			}
+			if err := flags.Parse([]string{"-o", test.value}); err != nil {
+				t.Fatal(err)
+			}
+			if err := checkOutputFormat(flags); (err != nil) != test.wantError {
+				t.Errorf("error: %v", err)
+			}
+		})
+	}
+	if err := checkOutputFormat(pflag.NewFlagSet("none", pflag.ContinueOnError)); err != nil {
+		t.Errorf("error without --output: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInspectStateDir(t *testing.T) {
+	oldest := time.Now().Add(-time.Hour).Truncate(time.Second)
+	tests := []struct {
+		name        string
+		files       map[string]string
+		missing     bool
+		wantErr     bool
+		want        StateReport
+		wantOldest  *time.Time
+		wantCursorT *time.Time
+	}{
+		{name: "missing", missing: true, wantErr: true},
+		{name: "empty"},
+		{
+			name: "pending batches",
+			files: map[string]string{
+				batchFilenamePrefix + "1000001" + batchFilenameSuffix:                      "12345",
+				batchFilenamePrefix + "1000002" + batchFilenameSuffix:                      "123",
+				batchFilenamePrefix + "1000002" + batchFilenameSuffix + metadataFileSuffix: "{}",
+				receiverCacheFilename: "https://endpoint1.collection.sumologic.com/receiver/v1/http/ZaVnC4dhaV39Tn37\n",
+			},
+			want: StateReport{
+				PendingBatches: 2,
+				PendingBytes:   8,
+				Receiver:       "https://endpoint1.collection.sumologic.com/receiver/v1/http/ZaVn****",
+			},
+			wantOldest: &oldest,
+		},
+		{
+			// The entry isn't in the journal, its time is taken from the cursor
+			name:        "cursor",
+			files:       map[string]string{cursorFilename: "s=0;i=1;b=0;m=1;t=5d9a7c7a1c2e0;x=0"},
+			want:        StateReport{Cursor: "s=0;i=1;b=0;m=1;t=5d9a7c7a1c2e0;x=0"},
+			wantCursorT: func() *time.Time { t := time.UnixMicro(0x5d9a7c7a1c2e0); return &t }(),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if test.missing {
+				dir = path.Join(dir, "missing")
+			}
+			for name, content := range test.files {
+				filename := path.Join(dir, name)
+				if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+					t.Fatal(err)
+				}
+				if strings.HasSuffix(name, "1000001"+batchFilenameSuffix) {
+					os.Chtimes(filename, oldest, oldest)
+				}
+			}
+
+			got, err := inspectStateDir(context.Background(), dir)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.StateDir != dir || got.Cursor != test.want.Cursor || got.PendingBatches != test.want.PendingBatches ||
+				got.PendingBytes != test.want.PendingBytes || got.Receiver != test.want.Receiver {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+			if (got.OldestBatch == nil) != (test.wantOldest == nil) || got.OldestBatch != nil && !got.OldestBatch.Equal(*test.wantOldest) {
+				t.Errorf("oldest batch is %v, want %v", got.OldestBatch, test.wantOldest)
+			}
+			if (got.CursorTime == nil) != (test.wantCursorT == nil) || got.CursorTime != nil && !got.CursorTime.Equal(*test.wantCursorT) {
+				t.Errorf("cursor time is %v, want %v", got.CursorTime, test.wantCursorT)
+			}
+		})
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	now := time.Date(2025, 1, 1, 10, 5, 3, 0, time.UTC)
+	at := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		t    *time.Time
+		want string
+	}{
+		{name: "unknown", want: "-"},
+		{name: "age", t: &at, want: "2025-01-01T10:00:00Z (5m3s ago)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := formatAge(test.t, now); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
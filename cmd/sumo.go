@@ -2,265 +2,529 @@ package cmd
 
 import (
 	"bytes"
-	"encoding/base64"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 )
 
-// sumoRESTAPIURL is the URL of the SumoLogic REST API. Note: this is the URL for the SumoLogic DE environment.
-const sumoRESTAPIURL = "https://api.de.sumologic.com/api/v1"
-const collectorNamePrefix = "jsumo-collector-"
-const sumoAccessIDEnvVar = "SUMO_ACCESSID"
-const sumoAccessKeyEnvVar = "SUMO_ACCESSKEY"
+// sumoPageSize is the number of objects requested per page when listing collectors and sources
+const sumoPageSize = 1000
+
+// ErrDuplicateName is returned when several objects with the same name exist in SumoLogic
+var ErrDuplicateName = errors.New("duplicate name")
 
 // GetReceiverURL returns the URL of the SumoLogic receiver which is used to send
-// logs to SumoLogic. The URL is constructed using the hostname of the machine.
-// If it doesn't exist, a new collector and source are created in SumoLogic.
-func GetReceiverURL() (string, error) {
-	hostname, err := os.Hostname()
+// logs to SumoLogic. The names of the collector and the source are rendered from
+// the naming templates, by default it is the hostname of the machine.
+// If it doesn't exist, a new collector and source are created in SumoLogic. Existing
+// collector and source are reconciled with the desired configuration. When metrics
+// are forwarded, the metrics source is provisioned in the same collector.
+func GetReceiverURL(ctx context.Context) (string, error) {
+	names, err := renderSumoNames()
 	if err != nil {
 		return "", err
 	}
-	DebugLogger.Println("System hostname:", hostname)
 
 	// Get the collector ID from the collector name
-	collectorID, err := getSumoCollectorIDFromName(hostname)
+	collectorID, err := getSumoCollectorIDFromName(ctx, names.Collector)
 	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			return "", err
+		}
 		// Create a new collector if it doesn't exist
-		DebugLogger.Println(red(err))
-		collectorID, err = createSumoCollector(hostname)
+		Logger.Debug("Collector not found", errAttr(err))
+		collectorID, err = createSumoCollector(ctx, names)
 		if err != nil {
 			return "", err
 		}
+	} else {
+		_, err = reconcileSumoCollector(ctx, collectorID, names, false)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Provision the metrics source. Logs are more important, so they aren't held back
+	// if it fails, it is provisioned again in the background
+	if Metrics.AutoProvisioned() {
+		metricsURL, err := getOrCreateSumoMetricsSource(ctx, collectorID, names)
+		if err != nil {
+			Metrics.RetryProvisioning(ctx, err)
+		} else {
+			Metrics.SetURL(metricsURL)
+		}
 	}
 
 	// Get the source receiver URL from the source name
-	receiverURL, err := getSumoHTTPSourceReceiverURLFromName(collectorID, hostname)
+	source, err := getSumoHTTPSourceFromName(ctx, collectorID, names.Source)
 	if err != nil {
-		// Create a new source if it doesn't exist
-		DebugLogger.Println(red(err))
-		receiverURL, err = createSumoHTTPSource(collectorID, hostname)
-		if err != nil {
+		if !errors.Is(err, ErrNotFound) {
 			return "", err
 		}
+		// Create a new source if it doesn't exist
+		Logger.Debug("Source not found", errAttr(err))
+		return createSumoHTTPSource(ctx, collectorID, names)
 	}
 
-	return receiverURL, nil
+	_, err = reconcileSumoHTTPSource(ctx, collectorID, source.ID, names, false)
+	if err != nil {
+		return "", err
+	}
+	return source.URL, nil
+}
 
+// provisionSumoMetricsSource returns the receiver URL of the metrics source in the
+// collector of the logs source. The source is created if it doesn't exist
+func provisionSumoMetricsSource(ctx context.Context) (string, error) {
+	names, err := renderSumoNames()
+	if err != nil {
+		return "", err
+	}
+	collectorID, err := getSumoCollectorIDFromName(ctx, names.Collector)
+	if err != nil {
+		return "", err
+	}
+	return getOrCreateSumoMetricsSource(ctx, collectorID, names)
 }
 
 // createSumoCollector creates a new collector in SumoLogic
-func createSumoCollector(name string) (int, error) {
-	DebugLogger.Println(green(fmt.Sprintf("Creating collector with name: %s", name)))
-	url := sumoRESTAPIURL + "/collectors"
+func createSumoCollector(ctx context.Context, names SumoNames) (int, error) {
+	Logger.Debug("Creating collector", "name", names.Collector)
+	collector := desiredCollectorProperties(names)
+	collector["collectorType"] = "Hosted"
 	body := map[string]interface{}{
-		"collector": map[string]interface{}{
-			"name":          name,
-			"description":   "Created by jsumo",
-			"collectorType": "Hosted",
-		},
-	}
-
-	respBodyBytes, err := makeRequest("POST", url, body)
-	if err != nil {
-		return 0, err
+		"collector": collector,
 	}
 
 	var response CollectorResponse
-	if err := json.Unmarshal(respBodyBytes, &response); err != nil {
+	err := SumoAPI.DoJSON(ctx, "POST", "/collectors", body, &response)
+	if err != nil {
 		return 0, err
 	}
 	return response.Collector.ID, nil
 }
 
-// getSumoCollectorIDFromName returns the ID of the collector with the given name
-func getSumoCollectorIDFromName(name string) (int, error) {
-	DebugLogger.Println(green(fmt.Sprintf("Getting collector ID with name: %s", name)))
-	url := sumoRESTAPIURL + "/collectors"
-	respBodyBytes, err := makeRequest("GET", url, nil)
-	if err != nil {
+// getSumoCollectorIDFromName returns the ID of the collector with the given name.
+// Collector names are unique in SumoLogic, so the collector is looked up directly by
+// its name. If the lookup endpoint fails, all collectors are listed instead
+func getSumoCollectorIDFromName(ctx context.Context, name string) (int, error) {
+	Logger.Debug("Getting collector ID", "name", name)
+	var response CollectorResponse
+	err := SumoAPI.DoJSON(ctx, "GET", "/collectors/name/"+url.PathEscape(name), nil, &response)
+	if err == nil {
+		return response.Collector.ID, nil
+	}
+	if errors.Is(err, ErrNotFound) {
+		return 0, fmt.Errorf("collector with name %s %w", name, ErrNotFound)
+	}
+	if errors.Is(err, ErrUnauthorized) || ctx.Err() != nil {
 		return 0, err
 	}
+	Logger.Debug("Direct collector lookup failed, listing all collectors", errAttr(err))
 
-	var collectors CollectorsListResponse
-	if err := json.Unmarshal(respBodyBytes, &collectors); err != nil {
+	collectors, err := listSumoCollectors(ctx)
+	if err != nil {
 		return 0, err
 	}
 
-	for _, collector := range collectors.Collectors {
+	ids := []int{}
+	for _, collector := range collectors {
 		if collector.Name == name {
-			return collector.ID, nil
+			ids = append(ids, collector.ID)
 		}
 	}
+	switch len(ids) {
+	case 0:
+		return 0, fmt.Errorf("collector with name %s %w", name, ErrNotFound)
+	case 1:
+		return ids[0], nil
+	default:
+		return 0, fmt.Errorf("%w: %d collectors with name %s found, IDs %v", ErrDuplicateName, len(ids), name, ids)
+	}
+}
 
-	return 0, fmt.Errorf("collector with name %s not found", name)
+// listSumoCollectors returns all collectors, reading all pages of the collectors list
+func listSumoCollectors(ctx context.Context) ([]Collector, error) {
+	collectors := []Collector{}
+	seen := map[int]bool{}
+	for offset := 0; ; offset += sumoPageSize {
+		var page CollectorsListResponse
+		err := SumoAPI.DoJSON(ctx, "GET", fmt.Sprintf("/collectors?limit=%d&offset=%d", sumoPageSize, offset), nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		added := 0
+		for _, collector := range page.Collectors {
+			// Protects from looping forever if the API ignores the offset
+			if seen[collector.ID] {
+				continue
+			}
+			seen[collector.ID] = true
+			collectors = append(collectors, collector)
+			added++
+		}
+		if len(page.Collectors) < sumoPageSize || added == 0 {
+			return collectors, nil
+		}
+	}
 }
 
 // createSumoHTTPSource creates a new HTTP source in SumoLogic
-func createSumoHTTPSource(collectorID int, sourceName string) (string, error) {
-	DebugLogger.Println(green(fmt.Sprintf("Creating HTTP source with name: %s", sourceName)))
-	url := sumoRESTAPIURL + "/collectors/" + fmt.Sprint(collectorID) + "/sources"
+func createSumoHTTPSource(ctx context.Context, collectorID int, names SumoNames) (string, error) {
+	Logger.Debug("Creating HTTP source", "name", names.Source)
 
 	// Ref for unique params: https://help.sumologic.com/docs/send-data/use-json-configure-sources/json-parameters-hosted-sources/#http-source
 	// Ref for common params: https://help.sumologic.com/docs/send-data/use-json-configure-sources/#common-parameters-for-log-source-types
+	source := desiredSourceProperties(names)
+	source["sourceType"] = "HTTP"
+	source["messagePerRequest"] = false
 	body := map[string]interface{}{
-		"source": map[string]interface{}{
-			"name":                       sourceName,
-			"description":                "Created by jsumo",
-			"sourceType":                 "HTTP",
-			"messagePerRequest":          false,
-			"multilineProcessingEnabled": true,
-			"hostName":                   sourceName,
-			"category":                   sourceName,
-		},
-	}
-
-	respBodyBytes, err := makeRequest("POST", url, body)
-	if err != nil {
-		return "", err
+		"source": source,
 	}
 
 	var response SourceResponse
-	if err := json.Unmarshal(respBodyBytes, &response); err != nil {
+	err := SumoAPI.DoJSON(ctx, "POST", fmt.Sprintf("/collectors/%d/sources", collectorID), body, &response)
+	if err != nil {
 		return "", err
 	}
 	return response.Source.URL, nil
 }
 
-// getSumoHTTPSourceReceiverURLFromName returns the URL of the HTTP source with the given name
-func getSumoHTTPSourceReceiverURLFromName(collectorID int, sourceName string) (string, error) {
-	DebugLogger.Println(green(fmt.Sprintf("Getting HTTP source URL with name: %s", sourceName)))
-	url := sumoRESTAPIURL + "/collectors/" + fmt.Sprint(collectorID) + "/sources"
-	respBodyBytes, err := makeRequest("GET", url, nil)
-	if err != nil {
+// getOrCreateSumoMetricsSource returns the receiver URL of the HTTP source which
+// receives metrics, the source is created if it doesn't exist
+func getOrCreateSumoMetricsSource(ctx context.Context, collectorID int, names SumoNames) (string, error) {
+	source, err := getSumoHTTPSourceFromName(ctx, collectorID, names.MetricsSource)
+	if err == nil {
+		return source.URL, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
 		return "", err
 	}
+	Logger.Debug("Creating HTTP metrics source", "name", names.MetricsSource)
+
+	// Log processing settings don't apply to metrics
+	properties := desiredSourceProperties(names)
+	for _, key := range []string{"automaticDateParsing", "multilineProcessingEnabled", "useAutolineMatching", "manualPrefixRegexp"} {
+		delete(properties, key)
+	}
+	properties["name"] = names.MetricsSource
+	properties["sourceType"] = "HTTP"
+	body := map[string]interface{}{
+		"source": properties,
+	}
 
-	var sources SourcesListResponse
-	if err := json.Unmarshal(respBodyBytes, &sources); err != nil {
+	var response SourceResponse
+	err = SumoAPI.DoJSON(ctx, "POST", fmt.Sprintf("/collectors/%d/sources", collectorID), body, &response)
+	if err != nil {
 		return "", err
 	}
+	return response.Source.URL, nil
+}
+
+// getSumoHTTPSourceFromName returns the HTTP source with the given name
+func getSumoHTTPSourceFromName(ctx context.Context, collectorID int, sourceName string) (Source, error) {
+	Logger.Debug("Getting HTTP source", "name", sourceName)
+	sources, err := listSumoSources(ctx, collectorID)
+	if err != nil {
+		return Source{}, err
+	}
 
-	for _, source := range sources.Sources {
+	found := []Source{}
+	for _, source := range sources {
 		if source.Name == sourceName {
-			return source.URL, nil
+			found = append(found, source)
 		}
 	}
+	switch len(found) {
+	case 0:
+		return Source{}, fmt.Errorf("source with name %s %w", sourceName, ErrNotFound)
+	case 1:
+		return found[0], nil
+	default:
+		ids := []int{}
+		for _, source := range found {
+			ids = append(ids, source.ID)
+		}
+		return Source{}, fmt.Errorf("%w: %d sources with name %s found in collector %d, IDs %v", ErrDuplicateName, len(ids), sourceName, collectorID, ids)
+	}
+}
 
-	return "", fmt.Errorf("source with name %s not found", sourceName)
+// listSumoSources returns all sources of the collector, reading all pages of the sources list
+func listSumoSources(ctx context.Context, collectorID int) ([]Source, error) {
+	sources := []Source{}
+	seen := map[int]bool{}
+	for offset := 0; ; offset += sumoPageSize {
+		var page SourcesListResponse
+		err := SumoAPI.DoJSON(ctx, "GET", fmt.Sprintf("/collectors/%d/sources?limit=%d&offset=%d", collectorID, sumoPageSize, offset), nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		added := 0
+		for _, source := range page.Sources {
+			// Protects from looping forever if the API ignores the offset
+			if seen[source.ID] {
+				continue
+			}
+			seen[source.ID] = true
+			sources = append(sources, source)
+			added++
+		}
+		if len(page.Sources) < sumoPageSize || added == 0 {
+			return sources, nil
+		}
+	}
+}
+
+// getSumoCollector returns the collector with the given ID
+func getSumoCollector(ctx context.Context, collectorID int) (Collector, error) {
+	var response CollectorResponse
+	err := SumoAPI.DoJSON(ctx, "GET", fmt.Sprintf("/collectors/%d", collectorID), nil, &response)
+	if err != nil {
+		return Collector{}, err
+	}
+	return response.Collector, nil
+}
+
+// deleteSumoCollector deletes the collector with the given ID together with its sources
+func deleteSumoCollector(ctx context.Context, collectorID int) error {
+	Logger.Debug("Deleting collector", "id", collectorID)
+	return SumoAPI.DoJSON(ctx, "DELETE", fmt.Sprintf("/collectors/%d", collectorID), nil, nil)
+}
+
+// getSumoSource returns the source with the given ID
+func getSumoSource(ctx context.Context, collectorID, sourceID int) (Source, error) {
+	var response SourceResponse
+	err := SumoAPI.DoJSON(ctx, "GET", fmt.Sprintf("/collectors/%d/sources/%d", collectorID, sourceID), nil, &response)
+	if err != nil {
+		return Source{}, err
+	}
+	return response.Source, nil
+}
+
+// deleteSumoSource deletes the source with the given ID
+func deleteSumoSource(ctx context.Context, collectorID, sourceID int) error {
+	Logger.Debug("Deleting source", "id", sourceID)
+	return SumoAPI.DoJSON(ctx, "DELETE", fmt.Sprintf("/collectors/%d/sources/%d", collectorID, sourceID), nil, nil)
+}
+
+// rotatingSourceSuffix is appended to the name of the new source until the old source is
+// deleted, as names of sources are unique in a collector
+const rotatingSourceSuffix = "-rotating"
+
+// recreateSumoSource replaces the source with a new one with the same configuration.
+// SumoLogic generates a new receiver URL for the new source, which invalidates the old one.
+// The new source is created under a temporary name before the old one is deleted and
+// then renamed, so the configuration is never lost. If a step fails, the error tells
+// what is left to do and the configuration is logged
+func recreateSumoSource(ctx context.Context, collectorID, sourceID int) (Source, error) {
+	endpoint := fmt.Sprintf("/collectors/%d/sources/%d", collectorID, sourceID)
+	var current map[string]map[string]interface{}
+	err := SumoAPI.DoJSON(ctx, "GET", endpoint, nil, &current)
+	if err != nil {
+		return Source{}, err
+	}
+	source, ok := current["source"]
+	if !ok {
+		return Source{}, fmt.Errorf("unexpected response from %s, source is missing", endpoint)
+	}
+	// Properties assigned by SumoLogic
+	for _, key := range []string{"id", "url", "alive", "createdAt", "createdBy", "modifiedAt", "modifiedBy"} {
+		delete(source, key)
+	}
+	name, _ := source["name"].(string)
+	configuration, err := json.Marshal(source)
+	if err != nil {
+		return Source{}, err
+	}
+	logConfiguration := func() {
+		Logger.Error("Configuration of the source", "id", sourceID, "source", string(configuration))
+	}
+
+	temporaryName := name + rotatingSourceSuffix
+	source["name"] = temporaryName
+	Logger.Debug("Creating source", "name", temporaryName)
+	var response SourceResponse
+	err = SumoAPI.DoJSON(ctx, "POST", fmt.Sprintf("/collectors/%d/sources", collectorID), map[string]interface{}{"source": source}, &response)
+	if err != nil {
+		return Source{}, fmt.Errorf("unable to create the new source, source %d is unchanged: %w", sourceID, err)
+	}
+	created := response.Source
+
+	err = deleteSumoSource(ctx, collectorID, sourceID)
+	if err != nil {
+		logConfiguration()
+		return created, fmt.Errorf("new source %d was created as %s, but source %d wasn't deleted, delete it and rename the new source to %s: %w",
+			created.ID, temporaryName, sourceID, name, err)
+	}
+
+	Logger.Debug("Renaming source", "id", created.ID, "name", name)
+	_, err = reconcileSumoObject(ctx, fmt.Sprintf("/collectors/%d/sources/%d", collectorID, created.ID), "source", map[string]interface{}{"name": name}, false)
+	if err != nil {
+		logConfiguration()
+		return created, fmt.Errorf("source %d was replaced with source %d, but it wasn't renamed from %s to %s: %w",
+			sourceID, created.ID, temporaryName, name, err)
+	}
+	created.Name = name
+	return created, nil
+}
+
+// ReceiverError is returned when the receiver responds with a non-2xx status code
+type ReceiverError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *ReceiverError) Error() string {
+	return fmt.Sprintf("HTTP error: status %s, %s", e.Status, e.Body)
+}
+
+// IsInvalidReceiver returns true if the receiver URL is no longer valid, e.g. the
+// HTTP source was deleted or its URL was rotated
+func (e *ReceiverError) IsInvalidReceiver() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden || e.StatusCode == http.StatusNotFound
+}
+
+// redactReceiverURL hides the secret token of the receiver URL, so it can be logged.
+// Only the first characters of the token are kept to tell receivers apart
+func redactReceiverURL(receiverURL string) string {
+	parsed, err := url.Parse(receiverURL)
+	if err != nil || parsed.Host == "" {
+		return "<redacted>"
+	}
+	segments := strings.Split(parsed.EscapedPath(), "/")
+	token := segments[len(segments)-1]
+	if len(token) > 4 {
+		token = token[:4]
+	}
+	segments[len(segments)-1] = token + "****"
+	return fmt.Sprintf("%s://%s%s", parsed.Scheme, parsed.Host, strings.Join(segments, "/"))
+}
+
+// receiverTokenRe matches the secret token of SumoLogic receiver URLs
+var receiverTokenRe = regexp.MustCompile(`(/receiver/v1/[a-z]+/)([A-Za-z0-9_=-]{0,4})[A-Za-z0-9_=-]*`)
+
+// redactSecrets hides the secret tokens of SumoLogic receiver URLs in the text, e.g.
+// in the responses of SumoLogic REST API
+func redactSecrets(text string) string {
+	return receiverTokenRe.ReplaceAllString(text, "$1$2****")
+}
+
+// redactURLError hides the receiver URL in the errors returned by the HTTP client
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = redactReceiverURL(urlErr.URL)
+	}
+	return err
+}
+
+// haveSumoCredentials returns true if the credentials for SumoLogic REST API are available.
+// An error is returned if they can't be read
+func haveSumoCredentials() (bool, error) {
+	for _, name := range []string{sumoAccessIDEnvVar, sumoAccessKeyEnvVar} {
+		found, err := Credentials.Has(name)
+		if !found || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
 }
 
 // uploadFileToSumoSource uploads a file to the SumoLogic source receiver URL
 // Ref: https://help.sumologic.com/docs/send-data/hosted-collectors/http-source/logs-metrics/upload-logs/
-func uploadFileToSumoSource(filename, receiverURL string) error {
+func uploadFileToSumoSource(ctx context.Context, filename, receiverURL string) error {
 	startedAt := time.Now()
-	defer func() {
-		DebugLogger.Printf("File uploaded %s, took %s\n", filename, time.Since(startedAt))
-	}()
-	DebugLogger.Println(green(fmt.Sprintf("Uploading file %s ...", filename)))
+	Logger.Debug("Uploading batch file...", attrFile, filename)
 	file, err := os.ReadFile(filename)
 	if err != nil {
 		if os.IsNotExist(err) {
-			DebugLogger.Println(yellow(fmt.Sprintf("File %s not found. Skipping upload.", filename)))
+			Logger.Debug("Batch file not found, skipping upload", attrFile, filename)
+			removeBatchMetadata(filename)
 			return nil
 		}
 		return err
 	}
+	metadata, err := readBatchMetadata(filename)
+	if err != nil {
+		return fmt.Errorf("unable to read metadata of %s: %w", filename, err)
+	}
 	client := &http.Client{
 		Timeout: 5 * time.Minute,
 	}
 
-	req, err := http.NewRequest("POST", receiverURL, bytes.NewBuffer(file))
+	req, err := http.NewRequestWithContext(ctx, "POST", receiverURL, bytes.NewBuffer(file))
 	if err != nil {
-		return err
+		return redactURLError(err)
 	}
 	req.Header.Set("Content-Encoding", "zstd")
-	if FlagSourceCategory != "" {
-		req.Header.Set("X-Sumo-Category", FlagSourceCategory)
-	}
+	metadata.setHeaders(req.Header)
 
-	DebugLogger.Println(blue(fmt.Sprintf("-- Making request POST %s", receiverURL)))
+	Logger.Debug("Making request", "method", req.Method, attrReceiver, redactReceiverURL(receiverURL))
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return redactURLError(err)
 	}
 	defer resp.Body.Close()
 
-	DebugLogger.Println(blue(fmt.Sprintf("Response status: %s", resp.Status)))
+	Logger.Debug("Response received", "status", resp.Status)
 	metricStatusCodesFromReceiver.WithLabelValues(fmt.Sprint(resp.StatusCode)).Inc()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
-	DebugLogger.Println(blue(fmt.Sprintf("Response body: %s", string(respBody))))
+	Logger.Debug("Response body", "body", string(respBody))
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("HTTP error: status %s, %s", resp.Status, string(respBody))
+		return &ReceiverError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(respBody)}
 	}
 
-	Logger.Printf("Uploaded %d bytes\n", len(file))
+	Logger.Info("Batch file uploaded",
+		attrFile, filename,
+		attrBytes, len(file),
+		attrDestination, metadata.DestinationName(),
+		attrReceiver, redactReceiverURL(receiverURL),
+		attrDuration, time.Since(startedAt),
+	)
 	metricBytesSentToReceiver.Add(float64(len(file)))
 
-	DebugLogger.Printf("Removing file %s\n", filename)
 	err = os.Remove(filename)
 	if err != nil {
-		Logger.Println(err)
+		Logger.Error("Unable to remove the uploaded batch file", attrFile, filename, errAttr(err))
 	}
+	removeBatchMetadata(filename)
 	return nil
 }
 
-// makeRequest makes an HTTP request to the SumoLogic REST API
-func makeRequest(method, url string, body map[string]interface{}) ([]byte, error) {
-	DebugLogger.Println(blue(fmt.Sprintf("-- Making request %s %s", method, url)))
+// probeReceiver checks if the receiver accepts requests by sending an empty POST request
+func probeReceiver(ctx context.Context, receiverURL string) error {
 	client := &http.Client{
 		Timeout: 10 * time.Second,
 	}
-	jsonBody, err := json.Marshal(body)
-	if err != nil {
-		return nil, err
-	}
-	DebugLogger.Println(blue(fmt.Sprintf("Request body: %s", string(jsonBody))))
-
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", receiverURL, http.NoBody)
 	if err != nil {
-		return nil, err
-	}
-
-	accessIDStr := os.Getenv(sumoAccessIDEnvVar)
-	if accessIDStr == "" {
-		return nil, fmt.Errorf("environment variable %s not set", sumoAccessIDEnvVar)
-	}
-
-	accessKeyStr := os.Getenv(sumoAccessKeyEnvVar)
-	if accessKeyStr == "" {
-		return nil, fmt.Errorf("environment variable %s not set", sumoAccessKeyEnvVar)
+		return redactURLError(err)
 	}
-
-	auth := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", accessIDStr, accessKeyStr)))
-	req.Header.Set("Authorization", "Basic "+auth)
-	req.Header.Set("Content-Type", "application/json")
-
+	req.Header.Set("Content-Type", "text/plain")
+	Logger.Debug("Making request", "method", req.Method, attrReceiver, redactReceiverURL(receiverURL))
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return redactURLError(err)
 	}
 	defer resp.Body.Close()
-	DebugLogger.Println(blue(fmt.Sprintf("Response status: %s", resp.Status)))
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	DebugLogger.Println(blue(fmt.Sprintf("Response body: %s", string(respBody))))
-
+	Logger.Debug("Response received", "status", resp.Status)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("HTTP error: status %s, %s", resp.Status, string(respBody))
+		return fmt.Errorf("HTTP error: status %s", resp.Status)
 	}
-
-	return respBody, nil
+	return nil
 }
@@ -0,0 +1,420 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sumoDeployments maps SumoLogic deployments to the URLs of their REST API
+// Ref: https://help.sumologic.com/docs/api/getting-started/#sumo-logic-endpoints-by-deployment-and-firewall-security
+var sumoDeployments = map[string]string{
+	"us1": "https://api.sumologic.com/api/v1",
+	"us2": "https://api.us2.sumologic.com/api/v1",
+	"eu":  "https://api.eu.sumologic.com/api/v1",
+	"de":  "https://api.de.sumologic.com/api/v1",
+	"au":  "https://api.au.sumologic.com/api/v1",
+	"jp":  "https://api.jp.sumologic.com/api/v1",
+	"ca":  "https://api.ca.sumologic.com/api/v1",
+	"in":  "https://api.in.sumologic.com/api/v1",
+	"fed": "https://api.fed.sumologic.com/api/v1",
+}
+
+// apiEndpointFilename is the file where the REST API URL discovered via redirects is
+// stored. The name of the deployment is appended, so the URL discovered for one deployment
+// isn't used when another one is selected
+const apiEndpointFilename = "jsumo-api-endpoint"
+
+// sumoAPIHostRe matches the hosts of SumoLogic REST API, e.g. api.sumologic.com or
+// api.us2.sumologic.com. Redirects to other hosts are refused, as the credentials are
+// sent to the new host
+var sumoAPIHostRe = regexp.MustCompile(`^api[a-z0-9-]*(\.[a-z0-9-]+)*\.sumologic\.com$`)
+
+// maxAPIRedirects is the maximum number of redirects followed for a single API request
+const maxAPIRedirects = 3
+
+// apiRetryMinBackoff and apiRetryMaxBackoff limit the interval between retries of
+// rate limited and failed API requests
+const apiRetryMinBackoff = 1 * time.Second
+const apiRetryMaxBackoff = 30 * time.Second
+
+const sumoAccessIDEnvVar = "SUMO_ACCESSID"
+const sumoAccessKeyEnvVar = "SUMO_ACCESSKEY"
+
+// ErrNotFound is returned when the object doesn't exist in SumoLogic
+var ErrNotFound = errors.New("not found")
+
+// ErrRateLimited is returned when the request was rate limited by SumoLogic API
+var ErrRateLimited = errors.New("rate limited")
+
+// ErrUnauthorized is returned when the credentials are invalid or have no access to the object
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrPreconditionFailed is returned when the object was modified since its ETag was read
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// APIError is the error response of SumoLogic API
+// Ref: https://help.sumologic.com/docs/api/troubleshooting/#status-codes
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Status     string `json:"-"`
+	ID         string `json:"id"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Errors     []struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Body string `json:"-"` // Raw response body, if it is not a JSON error
+}
+
+func (e *APIError) Error() string {
+	code, message := e.Code, e.Message
+	if code == "" && len(e.Errors) > 0 {
+		code, message = e.Errors[0].Code, e.Errors[0].Message
+	}
+	if code == "" {
+		return fmt.Sprintf("HTTP error: status %s, %s", e.Status, e.Body)
+	}
+	return fmt.Sprintf("SumoLogic API error: status %s, %s: %s", e.Status, code, message)
+}
+
+// Is allows to check the type of the error with errors.Is, e.g. errors.Is(err, ErrNotFound)
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrPreconditionFailed:
+		return e.StatusCode == http.StatusPreconditionFailed
+	}
+	return false
+}
+
+// newAPIError creates a new APIError from the response
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{}
+	if err := json.Unmarshal(body, apiErr); err != nil {
+		apiErr = &APIError{Body: string(body)}
+	}
+	apiErr.StatusCode = resp.StatusCode
+	apiErr.Status = resp.Status
+	if apiErr.Code == "" && len(apiErr.Errors) == 0 {
+		apiErr.Body = string(body)
+	}
+	return apiErr
+}
+
+// DebugHook is called after every attempt to make a request to SumoLogic API with
+// the request body and the response. The response is nil if the request failed
+type DebugHook func(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, err error)
+
+// SumoClient is a client for SumoLogic REST API. It authenticates the requests using
+// the credentials, follows redirects to the correct deployment and retries rate
+// limited and failed requests with backoff
+type SumoClient struct {
+	// BaseURL is the URL of SumoLogic REST API. If empty, it is selected with
+	// getSumoAPIURL, so the endpoint discovered via redirects is used
+	BaseURL    string
+	MaxRetries int
+	// MinBackoff and MaxBackoff limit the interval between retries, Retry-After of the
+	// response included
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	Hook        DebugHook
+	credentials *CredentialChain
+	httpClient  *http.Client
+}
+
+// Do makes a request to SumoLogic API. The endpoint is relative to the REST API URL,
+// e.g. /collectors. The body, if not nil, is sent as JSON
+func (c *SumoClient) Do(ctx context.Context, method, endpoint string, body interface{}, headers map[string]string) ([]byte, http.Header, error) {
+	var jsonBody []byte
+	if body != nil {
+		var err error
+		jsonBody, err = json.Marshal(body)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	accessIDStr, err := c.credentials.Get(sumoAccessIDEnvVar)
+	if err != nil {
+		return nil, nil, err
+	}
+	accessKeyStr, err := c.credentials.Get(sumoAccessKeyEnvVar)
+	if err != nil {
+		return nil, nil, err
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", accessIDStr, accessKeyStr)))
+
+	apiURL := c.BaseURL
+	if apiURL == "" {
+		apiURL, err = getSumoAPIURL()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	redirects := 0
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, apiURL+endpoint, bytes.NewReader(jsonBody))
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header.Set("Authorization", "Basic "+auth)
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			c.hook(req, jsonBody, nil, nil, err)
+			if ctx.Err() != nil || !isIdempotent(method) || attempt >= c.MaxRetries {
+				return nil, nil, err
+			}
+			if err := c.wait(ctx, attempt, nil); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		c.hook(req, jsonBody, resp, respBody, err)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return respBody, resp.Header, nil
+
+		case resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.Header.Get("Location") != "":
+			// SumoLogic API redirects to the correct deployment when called on the wrong one
+			redirects++
+			if redirects > maxAPIRedirects {
+				return nil, nil, fmt.Errorf("too many redirects from SumoLogic API")
+			}
+			newAPIURL, err := apiURLFromRedirect(apiURL, resp.Header.Get("Location"))
+			if err != nil {
+				return nil, nil, err
+			}
+			Logger.Warn("SumoLogic API endpoint moved", "url", newAPIURL)
+			if c.BaseURL == "" {
+				if err := saveSumoAPIURL(newAPIURL); err != nil {
+					Logger.Error("Unable to save SumoLogic API URL", errAttr(err))
+				}
+			}
+			apiURL = newAPIURL
+			attempt--
+			continue
+		}
+
+		apiErr := newAPIError(resp, respBody)
+		// Rate limited requests weren't processed and can be always retried. Server
+		// errors are retried only if repeating the request is safe
+		retryable := resp.StatusCode == http.StatusTooManyRequests || (resp.StatusCode >= 500 && isIdempotent(method))
+		if !retryable || attempt >= c.MaxRetries {
+			return nil, nil, apiErr
+		}
+		Logger.Debug("Retrying request", "method", method, "endpoint", endpoint, errAttr(apiErr))
+		if err := c.wait(ctx, attempt, resp); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// DoJSON makes a request to SumoLogic API and decodes the response into out, if it is not nil
+func (c *SumoClient) DoJSON(ctx context.Context, method, endpoint string, body interface{}, out interface{}) error {
+	respBody, _, err := c.Do(ctx, method, endpoint, body, nil)
+	if err != nil {
+		return err
+	}
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// retryDelay returns the delay before the next attempt. It is taken from Retry-After
+// header of the response or grows exponentially with the number of attempts. The delay
+// is capped at MaxBackoff, so a bogus Retry-After doesn't stall the client
+func (c *SumoClient) retryDelay(attempt int, resp *http.Response) time.Duration {
+	delay := c.MinBackoff << attempt
+	if delay > c.MaxBackoff || delay <= 0 {
+		delay = c.MaxBackoff
+	}
+	// Jitter spreads the retries of many hosts provisioned at the same time
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	if resp == nil {
+		return delay
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return delay
+	}
+	// Compared in seconds, so a huge value doesn't overflow
+	if seconds > int(c.MaxBackoff/time.Second) {
+		Logger.Warn("Retry-After of SumoLogic API is too long, retrying earlier", "retry_after", seconds, "in", c.MaxBackoff)
+		return c.MaxBackoff
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// wait sleeps before the next attempt, see retryDelay
+func (c *SumoClient) wait(ctx context.Context, attempt int, resp *http.Response) error {
+	timer := time.NewTimer(c.retryDelay(attempt, resp))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *SumoClient) hook(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, err error) {
+	if c.Hook != nil {
+		c.Hook(req, reqBody, resp, respBody, err)
+	}
+}
+
+// isIdempotent returns true if repeating the request with the method is safe
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// debugLogHook logs requests to SumoLogic API in debug mode
+func debugLogHook(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, err error) {
+	Logger.Debug("Making request", "method", req.Method, "url", req.URL.String())
+	if len(reqBody) > 0 {
+		Logger.Debug("Request body", "body", string(reqBody))
+	}
+	if err != nil {
+		Logger.Debug("Request failed", errAttr(err))
+	}
+	if resp != nil {
+		Logger.Debug("Response received", "status", resp.Status, "body", redactSecrets(string(respBody)))
+	}
+}
+
+// NewSumoClient creates a new client for SumoLogic REST API
+func NewSumoClient(credentials *CredentialChain) *SumoClient {
+	// Cookies are required by the Search Job API to route the requests of the job
+	// to the same node
+	jar, _ := cookiejar.New(nil)
+	return &SumoClient{
+		MaxRetries:  5,
+		MinBackoff:  apiRetryMinBackoff,
+		MaxBackoff:  apiRetryMaxBackoff,
+		Hook:        debugLogHook,
+		credentials: credentials,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Jar:     jar,
+			// Redirects are handled manually to discover the correct deployment
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// getSumoAPIURL returns the URL of the SumoLogic REST API. The explicitly provided URL
+// has the highest priority, then the URL discovered via redirects for the selected
+// deployment and finally the URL of the selected deployment
+func getSumoAPIURL() (string, error) {
+	if FlagSumoAPIURL != "" {
+		return strings.TrimSuffix(FlagSumoAPIURL, "/"), nil
+	}
+	deployment := strings.ToLower(FlagSumoDeployment)
+	apiURL, ok := sumoDeployments[deployment]
+	if !ok {
+		return "", fmt.Errorf("unknown SumoLogic deployment %q", FlagSumoDeployment)
+	}
+
+	filename, err := apiEndpointPath(deployment)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if cached := string(bytes.TrimSpace(data)); cached != "" {
+		if parsed, err := url.Parse(cached); err == nil && isSumoAPIURL(parsed) {
+			return cached, nil
+		}
+		Logger.Warn("Ignoring invalid cached SumoLogic API URL", attrFile, filename)
+	}
+	return apiURL, nil
+}
+
+// apiEndpointPath returns the file with the REST API URL discovered for the deployment
+func apiEndpointPath(deployment string) (string, error) {
+	stateDir, err := getStateDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(stateDir, apiEndpointFilename+"-"+deployment), nil
+}
+
+// saveSumoAPIURL remembers the REST API URL discovered via redirects for the selected
+// deployment in the working directory
+func saveSumoAPIURL(apiURL string) error {
+	filename, err := apiEndpointPath(strings.ToLower(FlagSumoDeployment))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte(apiURL), 0644)
+}
+
+// isSumoAPIURL returns true if the URL points to SumoLogic REST API over HTTPS
+func isSumoAPIURL(u *url.URL) bool {
+	return u.Scheme == "https" && u.Port() == "" && sumoAPIHostRe.MatchString(strings.ToLower(u.Hostname()))
+}
+
+// apiURLFromRedirect returns the REST API URL from the location the API redirected
+// to. SumoLogic API redirects to the correct deployment when called on the wrong one
+func apiURLFromRedirect(apiURL string, location string) (string, error) {
+	current, err := url.Parse(apiURL)
+	if err != nil {
+		return "", err
+	}
+	redirect, err := current.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	if redirect.Host == "" {
+		return "", fmt.Errorf("invalid redirect location %q", location)
+	}
+	if !isSumoAPIURL(redirect) {
+		return "", fmt.Errorf("refusing to follow the redirect to %s://%s, it is not SumoLogic API", redirect.Scheme, redirect.Host)
+	}
+	return fmt.Sprintf("%s://%s%s", redirect.Scheme, redirect.Host, current.Path), nil
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	client := &SumoClient{MinBackoff: apiRetryMinBackoff, MaxBackoff: apiRetryMaxBackoff}
+	tests := []struct {
+		name       string
+		attempt    int
+		retryAfter string
+		min, max   time.Duration
+	}{
+		{name: "first attempt", attempt: 0, min: 500 * time.Millisecond, max: time.Second},
+		{name: "exponential backoff", attempt: 3, min: 4 * time.Second, max: 8 * time.Second},
+		{name: "capped backoff", attempt: 10, min: 15 * time.Second, max: 30 * time.Second},
+		{name: "overflowing backoff", attempt: 70, min: 15 * time.Second, max: 30 * time.Second},
+		{name: "Retry-After", attempt: 0, retryAfter: "5", min: 5 * time.Second, max: 5 * time.Second},
+		{name: "Retry-After at the cap", attempt: 0, retryAfter: "30", min: 30 * time.Second, max: 30 * time.Second},
+		{name: "Retry-After above the cap", attempt: 0, retryAfter: "3600", min: 30 * time.Second, max: 30 * time.Second},
+		{name: "overflowing Retry-After", attempt: 0, retryAfter: "9999999999999", min: 30 * time.Second, max: 30 * time.Second},
+		{name: "zero Retry-After", attempt: 0, retryAfter: "0", min: 500 * time.Millisecond, max: time.Second},
+		{name: "Retry-After as a date", attempt: 0, retryAfter: "Wed, 21 Oct 2015 07:28:00 GMT", min: 500 * time.Millisecond, max: time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if test.retryAfter != "" {
+				resp.Header.Set("Retry-After", test.retryAfter)
+			}
+			for i := 0; i < 20; i++ {
+				if got := client.retryDelay(test.attempt, resp); got < test.min || got > test.max {
+					t.Fatalf("delay %s, want %s-%s", got, test.min, test.max)
+				}
+			}
+		})
+	}
+}
+
+func TestSumoClientDo(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		statuses     []int // Statuses of the responses, the last one is repeated
+		retryAfter   string
+		wantStatus   int // Status of the returned error, 0 if the request succeeds
+		wantRequests int32
+	}{
+		{name: "success", method: http.MethodGet, statuses: []int{200}, wantRequests: 1},
+		{name: "rate limited", method: http.MethodPost, statuses: []int{429, 200}, wantRequests: 2},
+		{name: "rate limited with long Retry-After", method: http.MethodPost, statuses: []int{429, 429, 200}, retryAfter: "3600", wantRequests: 3},
+		{name: "rate limited until retries run out", method: http.MethodGet, statuses: []int{429}, wantStatus: 429, wantRequests: 3},
+		{name: "server error of idempotent request", method: http.MethodGet, statuses: []int{503, 502, 200}, wantRequests: 3},
+		{name: "server error of POST isn't retried", method: http.MethodPost, statuses: []int{500}, wantStatus: 500, wantRequests: 1},
+		{name: "not found", method: http.MethodGet, statuses: []int{404}, wantStatus: 404, wantRequests: 1},
+		{name: "unauthorized", method: http.MethodGet, statuses: []int{401}, wantStatus: 401, wantRequests: 1},
+		{name: "forbidden", method: http.MethodDelete, statuses: []int{403}, wantStatus: 403, wantRequests: 1},
+		{name: "precondition failed", method: http.MethodPut, statuses: []int{412}, wantStatus: 412, wantRequests: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests atomic.Int32
+			newTestSumoAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(requests.Add(1))
+				status := test.statuses[min(n, len(test.statuses))-1]
+				if r.Header.Get("Authorization") == "" || r.Method != test.method {
+					status = http.StatusBadRequest
+				}
+				if test.retryAfter != "" {
+					w.Header().Set("Retry-After", test.retryAfter)
+				}
+				w.WriteHeader(status)
+				fmt.Fprint(w, `{"code": "test", "message": "response"}`)
+			}))
+			SumoAPI.MaxRetries = 2
+			SumoAPI.MinBackoff = time.Millisecond
+			// Retry-After above the cap is replaced with the cap
+			SumoAPI.MaxBackoff = 10 * time.Millisecond
+
+			startedAt := time.Now()
+			_, _, err := SumoAPI.Do(context.Background(), test.method, "/collectors", nil, nil)
+			var apiErr *APIError
+			switch {
+			case test.wantStatus == 0 && err != nil:
+				t.Fatal(err)
+			case test.wantStatus != 0 && (!errors.As(err, &apiErr) || apiErr.StatusCode != test.wantStatus):
+				t.Fatalf("error %v, want status %d", err, test.wantStatus)
+			}
+			if got := requests.Load(); got != test.wantRequests {
+				t.Errorf("%d requests, want %d", got, test.wantRequests)
+			}
+			if elapsed := time.Since(startedAt); elapsed > 5*time.Second {
+				t.Errorf("took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestSumoClientDoInterrupted(t *testing.T) {
+	newTestSumoAPI(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "20")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	SumoAPI.MaxRetries = 5
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err := SumoAPI.Do(ctx, http.MethodGet, "/collectors", nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v, want deadline exceeded", err)
+	}
+}
+
+func TestAPIErrorIs(t *testing.T) {
+	tests := []struct {
+		status int
+		target error
+		want   bool
+	}{
+		{404, ErrNotFound, true},
+		{429, ErrRateLimited, true},
+		{401, ErrUnauthorized, true},
+		{403, ErrUnauthorized, true},
+		{412, ErrPreconditionFailed, true},
+		{500, ErrNotFound, false},
+		{404, ErrUnauthorized, false},
+	}
+	for _, test := range tests {
+		err := fmt.Errorf("wrapped: %w", &APIError{StatusCode: test.status})
+		if got := errors.Is(err, test.target); got != test.want {
+			t.Errorf("errors.Is(%d, %v) = %t, want %t", test.status, test.target, got, test.want)
+		}
+	}
+}
+
+func TestAPIErrorMessage(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"code": "collector.notfound", "message": "Collector not found"}`, "SumoLogic API error: status 404 Not Found, collector.notfound: Collector not found"},
+		{`{"errors": [{"code": "field.invalid", "message": "Invalid name"}]}`, "SumoLogic API error: status 404 Not Found, field.invalid: Invalid name"},
+		{`<html>gateway</html>`, "HTTP error: status 404 Not Found, <html>gateway</html>"},
+	}
+	for _, test := range tests {
+		resp := &http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+		if got := newAPIError(resp, []byte(test.body)).Error(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestApiURLFromRedirect(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+		want     string
+		wantErr  bool
+	}{
+		{name: "other deployment", location: "https://api.us2.sumologic.com/api/v1/collectors", want: "https://api.us2.sumologic.com/api/v1"},
+		{name: "uppercase host", location: "https://API.DE.SUMOLOGIC.COM/api/v1/collectors", want: "https://API.DE.SUMOLOGIC.COM/api/v1"},
+		{name: "relative location", location: "/api/v1/collectors", want: "https://api.sumologic.com/api/v1"},
+		{name: "plain http", location: "http://api.us2.sumologic.com/api/v1/collectors", wantErr: true},
+		{name: "explicit port", location: "https://api.us2.sumologic.com:8443/api/v1/collectors", wantErr: true},
+		{name: "other domain", location: "https://api.example.com/api/v1/collectors", wantErr: true},
+		{name: "lookalike domain", location: "https://api.sumologic.com.example.com/api/v1/collectors", wantErr: true},
+		{name: "suffix without dot", location: "https://api.evilsumologic.com/api/v1/collectors", wantErr: true},
+		{name: "not an API host", location: "https://collectors.sumologic.com/api/v1/collectors", wantErr: true},
+		{name: "credentials in the URL", location: "https://user@api.example.com/api/v1/collectors", wantErr: true},
+		{name: "invalid location", location: "https://%zz", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := apiURLFromRedirect("https://api.sumologic.com/api/v1", test.location)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsSumoAPIURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://api.sumologic.com/api/v1", true},
+		{"https://api.us2.sumologic.com/api/v1", true},
+		{"https://api.fed.sumologic.com/api/v1", true},
+		{"https://api.sumologic.com:443/api/v1", false},
+		{"http://api.sumologic.com/api/v1", false},
+		{"https://sumologic.com/api/v1", false},
+		{"https://api.sumologic.com.evil.io/api/v1", false},
+		{"https://evil.io/api.sumologic.com", false},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			u, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := isSumoAPIURL(u); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeSources is a collector of the SumoLogic API with HTTP sources, requests can be
+// made to fail by method
+type fakeSources struct {
+	sources  map[int]map[string]interface{}
+	nextID   int
+	fail     map[string]bool // Methods which fail
+	requests []string
+}
+
+func (f *fakeSources) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	if f.fail[r.Method] {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"code": "internal", "message": "failed"}`)
+		return
+	}
+	var id int
+	fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/collectors/1/sources/"), "%d", &id)
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, id))
+		json.NewEncoder(w).Encode(map[string]interface{}{"source": f.sources[id]})
+	case http.MethodPost:
+		var body map[string]map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		source := body["source"]
+		source["id"] = f.nextID
+		source["url"] = fmt.Sprintf("https://collectors/receiver/v1/http/token%d", f.nextID)
+		f.sources[f.nextID] = source
+		f.nextID++
+		json.NewEncoder(w).Encode(map[string]interface{}{"source": source})
+	case http.MethodPut:
+		var body map[string]map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.sources[id] = body["source"]
+		json.NewEncoder(w).Encode(body)
+	case http.MethodDelete:
+		delete(f.sources, id)
+	}
+}
+
+func TestRecreateSumoSource(t *testing.T) {
+	tests := []struct {
+		name      string
+		fail      string
+		wantErr   bool
+		wantNames []string // Names of the sources left, by ID
+	}{
+		{name: "replaced", wantNames: []string{"3:web"}},
+		{name: "create fails", fail: http.MethodPost, wantErr: true, wantNames: []string{"2:web"}},
+		{name: "delete fails", fail: http.MethodDelete, wantErr: true, wantNames: []string{"2:web", "3:web-rotating"}},
+		{name: "rename fails", fail: http.MethodPut, wantErr: true, wantNames: []string{"3:web-rotating"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &fakeSources{
+				sources: map[int]map[string]interface{}{
+					2: {"id": 2, "name": "web", "sourceType": "HTTP", "category": "prod", "url": "https://collectors/receiver/v1/http/old", "alive": true},
+				},
+				nextID: 3,
+				fail:   map[string]bool{test.fail: true},
+			}
+			newTestSumoAPI(t, fake)
+
+			source, err := recreateSumoSource(context.Background(), 1, 2)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error: %v", err)
+			}
+			names := []string{}
+			for _, id := range []int{2, 3} {
+				if s, ok := fake.sources[id]; ok {
+					names = append(names, fmt.Sprintf("%d:%s", id, s["name"]))
+				}
+			}
+			if fmt.Sprint(names) != fmt.Sprint(test.wantNames) {
+				t.Errorf("sources are %v, want %v, requests %v", names, test.wantNames, fake.requests)
+			}
+			if created, ok := fake.sources[3]; ok && created["category"] != "prod" {
+				t.Errorf("configuration wasn't copied: %v", created)
+			}
+			if !test.wantErr && (source.ID != 3 || source.Name != "web" || !strings.HasSuffix(source.URL, "token3")) {
+				t.Errorf("returned source %+v", source)
+			}
+		})
+	}
+}
+
+func TestTableReceiverURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		showURL bool
+		want    string
+	}{
+		{"https://endpoint1.collection.sumologic.com/receiver/v1/http/ZaVnC4dhaV39Tn37", false, "https://endpoint1.collection.sumologic.com/receiver/v1/http/ZaVn****"},
+		{"https://endpoint1.collection.sumologic.com/receiver/v1/http/ZaVnC4dhaV39Tn37", true, "https://endpoint1.collection.sumologic.com/receiver/v1/http/ZaVnC4dhaV39Tn37"},
+		{"", false, ""},
+		{"not a url", false, "<redacted>"},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s %t", test.url, test.showURL), func(t *testing.T) {
+			previous := FlagSumoShowURL
+			t.Cleanup(func() { FlagSumoShowURL = previous })
+			FlagSumoShowURL = test.showURL
+			if got := tableReceiverURL(test.url); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// fakePages serves the list of objects page by page using limit and offset, unless the
+// offset is ignored as by a misbehaving API
+type fakePages struct {
+	key          string // Key of the list in the response
+	total        int
+	ignoreOffset bool
+	requests     int
+}
+
+func (f *fakePages) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests++
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if f.ignoreOffset {
+		offset = 0
+	}
+	page := []map[string]interface{}{}
+	for id := offset; id < min(offset+limit, f.total); id++ {
+		page = append(page, map[string]interface{}{"id": id + 1, "name": fmt.Sprint("object", id)})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{f.key: page})
+}
+
+func TestListSumoPages(t *testing.T) {
+	tests := []struct {
+		name         string
+		total        int
+		ignoreOffset bool
+		want         int
+		wantRequests int
+	}{
+		{name: "empty", total: 0, want: 0, wantRequests: 1},
+		{name: "single page", total: sumoPageSize - 1, want: sumoPageSize - 1, wantRequests: 1},
+		{name: "full page", total: sumoPageSize, want: sumoPageSize, wantRequests: 2},
+		{name: "several pages", total: 2*sumoPageSize + 500, want: 2*sumoPageSize + 500, wantRequests: 3},
+		{name: "offset ignored", total: 3 * sumoPageSize, ignoreOffset: true, want: sumoPageSize, wantRequests: 2},
+	}
+	lists := []struct {
+		key  string
+		list func(ctx context.Context) (int, error)
+	}{
+		{"collectors", func(ctx context.Context) (int, error) {
+			collectors, err := listSumoCollectors(ctx)
+			return len(collectors), err
+		}},
+		{"sources", func(ctx context.Context) (int, error) {
+			sources, err := listSumoSources(ctx, 1)
+			return len(sources), err
+		}},
+	}
+	for _, list := range lists {
+		for _, test := range tests {
+			t.Run(list.key+" "+test.name, func(t *testing.T) {
+				api := &fakePages{key: list.key, total: test.total, ignoreOffset: test.ignoreOffset}
+				newTestSumoAPI(t, api)
+				got, err := list.list(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != test.want {
+					t.Errorf("listed %d, want %d", got, test.want)
+				}
+				if api.requests != test.wantRequests {
+					t.Errorf("%d requests, want %d", api.requests, test.wantRequests)
+				}
+			})
+		}
+	}
+}
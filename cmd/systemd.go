@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// notifySocketEnvVar is set by systemd to the socket which receives the state of the
+// service when it is started with Type=notify
+// Ref: https://www.freedesktop.org/software/systemd/man/latest/sd_notify.html
+const notifySocketEnvVar = "NOTIFY_SOCKET"
+
+// watchdogUsecEnvVar and watchdogPidEnvVar are set by systemd when WatchdogSec= is configured
+const watchdogUsecEnvVar = "WATCHDOG_USEC"
+const watchdogPidEnvVar = "WATCHDOG_PID"
+
+// systemdStatusInterval is the interval to update the status of the service
+const systemdStatusInterval = 10 * time.Second
+
+// sdNotify sends the state to systemd, e.g. READY=1. It does nothing if jsumo wasn't
+// started by systemd with Type=notify
+func sdNotify(state string) error {
+	socket := os.Getenv(notifySocketEnvVar)
+	if socket == "" {
+		return nil
+	}
+	// Abstract socket
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogTimeout returns the watchdog timeout configured for the service or 0 if
+// the watchdog is disabled
+func watchdogTimeout() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv(watchdogUsecEnvVar), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv(watchdogPidEnvVar); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// SystemdNotifier reports the state of jsumo to systemd: readiness, status with the
+// length of the upload queue and the lag, and watchdog pings which are sent only while
+// the reader and the uploader are alive, see HealthTracker. All methods are safe to call
+// on a nil notifier, which means that jsumo isn't running under systemd
+type SystemdNotifier struct {
+	sync.Mutex
+	ready    bool
+	watchdog time.Duration
+}
+
+// notify sends the state to systemd and logs the error
+func (n *SystemdNotifier) notify(state string) {
+	err := sdNotify(state)
+	if err != nil {
+		Logger.Error("Unable to notify systemd", errAttr(err))
+	}
+}
+
+// Ready tells systemd that jsumo has started. It is sent once
+func (n *SystemdNotifier) Ready() {
+	if n == nil {
+		return
+	}
+	n.Lock()
+	if n.ready {
+		n.Unlock()
+		return
+	}
+	n.ready = true
+	n.Unlock()
+	n.notify("READY=1\nSTATUS=" + n.status())
+	Logger.Debug("systemd notified: ready")
+}
+
+// Provisioning tells systemd that jsumo waits for the receiver URL. The start timeout
+// is extended past the next attempt, so systemd doesn't kill jsumo while it retries
+func (n *SystemdNotifier) Provisioning(retryIn time.Duration) {
+	if n == nil {
+		return
+	}
+	n.Lock()
+	ready := n.ready
+	n.Unlock()
+	if ready {
+		return
+	}
+	extendBy := retryIn + provisionMaxBackoff
+	n.notify(fmt.Sprintf("EXTEND_TIMEOUT_USEC=%d\nSTATUS=waiting for receiver URL", extendBy.Microseconds()))
+}
+
+// Stopping tells systemd that jsumo is shutting down
+func (n *SystemdNotifier) Stopping() {
+	if n == nil {
+		return
+	}
+	n.notify(fmt.Sprintf("STOPPING=1\nSTATUS=Shutting down, %d files in the queue", UploadQueue.Len()))
+}
+
+// status returns the status line: the length of the upload queue and the lag, which
+// is the age of the oldest batch file waiting for the upload
+func (n *SystemdNotifier) status() string {
+	files := UploadQueue.Files()
+	if Receivers.Current() == "" {
+		return fmt.Sprintf("Waiting for the receiver URL, queue: %d files", len(files))
+	}
+	lag := time.Duration(0)
+	if len(files) > 0 {
+		if info, err := os.Stat(files[0]); err == nil {
+			lag = time.Since(info.ModTime()).Round(time.Second)
+		}
+	}
+	if Admin.Paused() {
+		return fmt.Sprintf("Uploads are paused, queue: %d files, lag: %s", len(files), lag)
+	}
+	return fmt.Sprintf("Forwarding logs, queue: %d files, lag: %s", len(files), lag)
+}
+
+// Start updates the status and pings the watchdog until the context is cancelled
+func (n *SystemdNotifier) Start(ctx context.Context) {
+	if n == nil {
+		return
+	}
+	interval := systemdStatusInterval
+	if n.watchdog > 0 {
+		// Ping the watchdog twice per timeout as recommended by sd_watchdog_enabled(3)
+		interval = min(interval, n.watchdog/2)
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				state := "STATUS=" + n.status()
+				if n.watchdog > 0 {
+					if stalled := Health.Stalled(n.watchdog); len(stalled) > 0 {
+						Logger.Error("Watchdog isn't pinged", "stalled", strings.Join(stalled, ","))
+					} else {
+						state += "\nWATCHDOG=1"
+					}
+				}
+				n.notify(state)
+			}
+		}
+	}()
+}
+
+// NewSystemdNotifier returns a notifier if jsumo was started by systemd with Type=notify,
+// otherwise nil
+func NewSystemdNotifier() *SystemdNotifier {
+	if os.Getenv(notifySocketEnvVar) == "" {
+		return nil
+	}
+	return &SystemdNotifier{watchdog: watchdogTimeout()}
+}
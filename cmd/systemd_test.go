@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSystemdQuote(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"/usr/bin/jsumo", "/usr/bin/jsumo"},
+		{"--category", "--category"},
+		{"prod/{{unit}}", "prod/{{unit}}"},
+		{"", `""`},
+		{"two words", `"two words"`},
+		{"50%", "50%%"},
+		{"$HOME", "$$HOME"},
+		{`say "hi"`, `"say \"hi\""`},
+		{`C:\path`, `"C:\\path"`},
+		{"it's", `"it's"`},
+		{"a;b", `"a;b"`},
+		{"line\nbreak", `"line\nbreak"`},
+	}
+	for _, test := range tests {
+		t.Run(test.arg, func(t *testing.T) {
+			if got := systemdQuote(test.arg); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSystemdDuration(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		want     string
+	}{
+		{10 * time.Minute, "10min"},
+		{45 * time.Second, "45s"},
+		{90 * time.Second, "90s"},
+		{1500 * time.Millisecond, "2s"},
+		{0, "0min"},
+	}
+	for _, test := range tests {
+		if got := systemdDuration(test.duration); got != test.want {
+			t.Errorf("systemdDuration(%s) = %s, want %s", test.duration, got, test.want)
+		}
+	}
+}
+
+func TestSystemdUnitTemplate(t *testing.T) {
+	for _, watchdog := range []string{"", "10min"} {
+		var unit bytes.Buffer
+		err := systemdUnitTemplate.Execute(&unit, map[string]interface{}{
+			"ExecStart":   "/usr/bin/jsumo --category prod",
+			"Credentials": []string{"sumo-accessid:/etc/jsumo/sumo-accessid"},
+			"Watchdog":    watchdog,
+			"TimeoutStop": "45s",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The start timeout is extended by jsumo while the receiver URL is provisioned
+		if strings.Contains(unit.String(), "TimeoutStartSec") {
+			t.Error("TimeoutStartSec is set")
+		}
+		for _, line := range []string{"Type=notify", "ExecStart=/usr/bin/jsumo --category prod", "LoadCredential=sumo-accessid:/etc/jsumo/sumo-accessid", "TimeoutStopSec=45s"} {
+			if !strings.Contains(unit.String(), "\n"+line+"\n") {
+				t.Errorf("%s is missing", line)
+			}
+		}
+		if hasWatchdog := strings.Contains(unit.String(), "WatchdogSec="+watchdog+"\n"); hasWatchdog != (watchdog != "") {
+			t.Errorf("watchdog %q: WatchdogSec set %t", watchdog, hasWatchdog)
+		}
+	}
+}
+
+func TestSystemdNotifier(t *testing.T) {
+	socket := path.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv(notifySocketEnvVar, socket)
+	t.Setenv(watchdogUsecEnvVar, "")
+	previous := Receivers
+	t.Cleanup(func() { Receivers = previous })
+	Receivers = NewReceiverPool([]string{"https://collectors/receiver/v1/http/token"}, 1)
+
+	received := func() string {
+		buffer := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return ""
+		}
+		return string(buffer[:n])
+	}
+
+	n := NewSystemdNotifier()
+	if n == nil {
+		t.Fatal("no notifier with NOTIFY_SOCKET set")
+	}
+	n.Provisioning(10 * time.Second)
+	if got := received(); !strings.HasPrefix(got, "EXTEND_TIMEOUT_USEC=310000000\n") {
+		t.Errorf("provisioning sent %q", got)
+	}
+	n.Ready()
+	if got := received(); !strings.HasPrefix(got, "READY=1\nSTATUS=Forwarding logs") {
+		t.Errorf("ready sent %q", got)
+	}
+	// Readiness is sent once and the timeout isn't extended after it
+	n.Ready()
+	n.Provisioning(10 * time.Second)
+	if got := received(); got != "" {
+		t.Errorf("sent %q after ready", got)
+	}
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// errReceiverNotResolved is returned when the receiver URL of the next batch file isn't
+// resolved yet
+var errReceiverNotResolved = errors.New("receiver URL is not resolved yet")
+
+// uploadNextBatch uploads the next batch file in the queue to its destination. The file
+// is returned to the queue if the upload fails, so the order of the files is kept. Files
+// of destinations whose last upload failed are skipped while files of other destinations
+// are waiting, then they are retried
+func uploadNextBatch(ctx context.Context) error {
+	fileToUpload := UploadQueue.NextWhere(func(filename string) bool {
+		return !FailingDestinations.IsFailing(batchDestination(filename))
+	})
+	if fileToUpload == "" {
+		fileToUpload = UploadQueue.Next()
+	}
+	if fileToUpload == "" {
+		Logger.Debug("No files to upload")
+		return nil
+	}
+	// In dry-run mode, the batch file is written out instead of being uploaded
+	if DryRun != nil {
+		err := DryRun.Write(fileToUpload)
+		if err != nil {
+			UploadQueue.ReturnFile(fileToUpload)
+		}
+		return err
+	}
+	destination := batchDestination(fileToUpload)
+	receiverURL, isDefault := batchReceiverURL(fileToUpload)
+	if receiverURL == "" {
+		UploadQueue.ReturnFile(fileToUpload)
+		FailingDestinations.SetFailing(destination, true)
+		return errReceiverNotResolved
+	}
+
+	err := uploadFileToSumoSource(ctx, fileToUpload, receiverURL)
+	if err != nil {
+		UploadQueue.ReturnFile(fileToUpload)
+		if ctx.Err() != nil {
+			// Interrupted by the shutdown, the file is uploaded after the restart
+			return ctx.Err()
+		}
+		FailingDestinations.SetFailing(destination, true)
+		metricErrorsWhenSendingToReceiver.Inc()
+		Health.ReportError(err)
+		// The same attributes as when the batch file is uploaded, so failures can be correlated
+		var size int64
+		if info, statErr := os.Stat(fileToUpload); statErr == nil {
+			size = info.Size()
+		}
+		Logger.Error("Upload failed", attrFile, fileToUpload, attrBytes, size, attrDestination, destination,
+			attrReceiver, redactReceiverURL(receiverURL), errAttr(err))
+		// Named destinations have no failover receivers, the upload is retried
+		if isDefault {
+			Receivers.ReportFailure(receiverURL)
+			var receiverErr *ReceiverError
+			if errors.As(err, &receiverErr) && receiverErr.IsInvalidReceiver() {
+				Receivers.ReresolvePrimary(ctx, receiverURL)
+			}
+		}
+		return err
+	}
+	FailingDestinations.SetFailing(destination, false)
+	if isDefault {
+		Receivers.ReportSuccess(receiverURL)
+	}
+	Health.ReportUpload()
+	Canary.Uploaded(fileToUpload)
+	return nil
+}
+
+// flushUploadQueue uploads the queued batch files until the queue is empty or the
+// context is cancelled. Failed uploads are retried every interval
+func flushUploadQueue(ctx context.Context, interval time.Duration) {
+	for UploadQueue.Len() > 0 && ctx.Err() == nil {
+		Logger.Warn("Flushing upload queue...", attrQueue, UploadQueue.Len())
+		err := uploadNextBatch(ctx)
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// runOnce reads new logs and uploads the batch files once, for --once. Batch files left
+// by the previous run are uploaded first. Failed uploads aren't retried, the batch files
+// are kept and uploaded by the next run
+func runOnce(ctx context.Context, journalReader *JournalReader) error {
+	leftovers := !journalReader.shouldReadNewLogs()
+	for {
+		if err := journalReader.ReadLogs(ctx); err != nil {
+			return err
+		}
+		for UploadQueue.Len() > 0 {
+			if err := uploadNextBatch(ctx); err != nil {
+				return fmt.Errorf("%w, %d files are left in the queue", err, UploadQueue.Len())
+			}
+		}
+		if !leftovers {
+			return nil
+		}
+		// Logs weren't read while the batch files of the previous run were queued
+		leftovers = false
+	}
+}
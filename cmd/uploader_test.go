@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testReceiver is a receiver which responds with its current status code
+type testReceiver struct {
+	*httptest.Server
+	status   atomic.Int32
+	requests atomic.Int32
+}
+
+func newTestReceiver(t *testing.T, status int) *testReceiver {
+	t.Helper()
+	receiver := &testReceiver{}
+	receiver.status.Store(int32(status))
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receiver.requests.Add(1)
+		w.WriteHeader(int(receiver.status.Load()))
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+// setTestDestinations points the default destination and the security destination to
+// the receivers and restores the previous ones after the test
+func setTestDestinations(t *testing.T, defaultReceiver, securityReceiver *testReceiver) {
+	t.Helper()
+	previousReceivers, previousDestinations, previousStates := Receivers, Destinations, FailingDestinations
+	t.Cleanup(func() {
+		Receivers, FailingDestinations = previousReceivers, previousStates
+		setDestinations(previousDestinations)
+	})
+	Receivers = NewReceiverPool([]string{defaultReceiver.URL}, 3)
+	setDestinations(map[string]string{"security": securityReceiver.URL})
+	FailingDestinations = &DestinationStates{}
+}
+
+func TestUploadNextBatchSkipsFailingDestination(t *testing.T) {
+	defaultReceiver := newTestReceiver(t, http.StatusOK)
+	securityReceiver := newTestReceiver(t, http.StatusServiceUnavailable)
+	setTestDestinations(t, defaultReceiver, securityReceiver)
+
+	metadata, err := NewMetadataRenderer("", "", "", nil, []string{"unit=sshd.service;destination=security"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := &JournalReader{workingDir: t.TempDir(), counter: initialCounter, since: time.Now(), metadata: metadata}
+	processTestLogs(t, reader, []string{
+		journalLine("c1", "sshd.service", "Accepted publickey"),
+		journalLine("c2", "nginx.service", "GET /"),
+	})
+	processTestLogs(t, reader, []string{journalLine("c3", "nginx.service", "GET /health")})
+	UploadQueue = Queue{}
+	files, err := batchFilesIn(reader.workingDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		UploadQueue.AddFile(file)
+	}
+	if len(files) != 3 || batchDestination(files[0]) != "security" {
+		t.Fatalf("unexpected batch files %q", files)
+	}
+
+	ctx := context.Background()
+	// The security batch is first, its upload fails and it goes back to the queue
+	if err := uploadNextBatch(ctx); err == nil {
+		t.Fatal("upload to the failing destination succeeded")
+	}
+	// The default batches are uploaded past it
+	for i := 0; i < 2; i++ {
+		if err := uploadNextBatch(ctx); err != nil {
+			t.Fatalf("upload %d to the default destination: %s", i, err)
+		}
+	}
+	if got := defaultReceiver.requests.Load(); got != 2 {
+		t.Errorf("%d uploads to the default destination, want 2", got)
+	}
+	if got := UploadQueue.Files(); len(got) != 1 || got[0] != files[0] {
+		t.Fatalf("queue is %q, want the security batch", got)
+	}
+
+	// Only the batch of the failing destination is left, so it is retried
+	if err := uploadNextBatch(ctx); err == nil {
+		t.Fatal("upload to the failing destination succeeded")
+	}
+	securityReceiver.status.Store(http.StatusOK)
+	if err := uploadNextBatch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := securityReceiver.requests.Load(); got != 3 {
+		t.Errorf("%d uploads to the security destination, want 3", got)
+	}
+	if UploadQueue.Len() != 0 || FailingDestinations.IsFailing("security") {
+		t.Errorf("queue has %d files, security failing: %t", UploadQueue.Len(), FailingDestinations.IsFailing("security"))
+	}
+}
+
+func TestUploadNextBatchKeepsOrderOfDestination(t *testing.T) {
+	defaultReceiver := newTestReceiver(t, http.StatusServiceUnavailable)
+	securityReceiver := newTestReceiver(t, http.StatusOK)
+	setTestDestinations(t, defaultReceiver, securityReceiver)
+
+	reader := &JournalReader{workingDir: t.TempDir(), counter: initialCounter, since: time.Now()}
+	processTestLogs(t, reader, []string{journalLine("c1", "nginx.service", "first")})
+	first := UploadQueue.Files()[0]
+	processTestLogs(t, reader, []string{journalLine("c2", "nginx.service", "second")})
+	UploadQueue.ReturnFile(first)
+
+	// The failed batch of the default destination stays before its later batches
+	for i := 0; i < 2; i++ {
+		if err := uploadNextBatch(context.Background()); err == nil {
+			t.Fatal("upload to the failing destination succeeded")
+		}
+		if got := UploadQueue.Files(); len(got) != 2 || got[0] != first {
+			t.Fatalf("queue is %q, want %s first", got, first)
+		}
+	}
+}